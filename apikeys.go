@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// a personal api key as the owner sees it, the key itself is only in the
+// response to creating it
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type APIKeyWithSecret struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func apiKeyFromDB(dbKey database.ApiKey) APIKey {
+	apiKey := APIKey{
+		ID:        dbKey.ID,
+		CreatedAt: dbKey.CreatedAt,
+		Name:      dbKey.Name,
+		Prefix:    dbKey.KeyPrefix,
+		Scopes:    dbKey.Scopes,
+	}
+	if dbKey.ExpiresAt.Valid {
+		apiKey.ExpiresAt = &dbKey.ExpiresAt.Time
+	}
+	if dbKey.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &dbKey.LastUsedAt.Time
+	}
+	return apiKey
+}
+
+// managing keys takes a real login, an api key can't mint more api keys
+func (cfg *apiConfig) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Name             string   `json:"name"`
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.Name == "" || len(params.Name) > 100 {
+		errorMsg = "name is required and at most 100 characters"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if err = auth.ValidateScopes(params.Scopes, auth.DelegatedScopes); err != nil {
+		errorMsg = fmt.Sprintf("invalid scopes: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.ExpiresInSeconds < 0 {
+		errorMsg = "expires_in_seconds can't be negative"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	// no expiry unless asked for, bots shouldn't break on a schedule
+	var expiresAt sql.NullTime
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(params.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		errorMsg = fmt.Sprintf("error generating api key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	dbKey, err := cfg.dbQueries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      params.Name,
+		KeyPrefix: key[:len(auth.APIKeyPrefix)+6],
+		KeyHash:   auth.HashToken(key),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not create api key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	response := APIKeyWithSecret{
+		APIKey: apiKeyFromDB(dbKey),
+		Key:    key,
+	}
+
+	if err = respondWithJSON(w, 201, response); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+func (cfg *apiConfig) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	dbKeys, err := cfg.dbQueries.ListUserAPIKeys(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list api keys: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	apiKeys := make([]APIKey, 0, len(dbKeys))
+	for _, dbKey := range dbKeys {
+		apiKeys = append(apiKeys, apiKeyFromDB(dbKey))
+	}
+
+	if err = respondWithJSON(w, 200, apiKeys); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+func (cfg *apiConfig) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeUserAPIKey(r.Context(), database.RevokeUserAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke api key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if revoked == 0 {
+		errorMsg = "no active api key with that id"
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// authorize is the one check every protected handler makes. it accepts an
+// access token or a personal api key (as "ApiKey chirpy_..." or as a bearer
+// token), and whichever it is has to carry the scope. answers 401/403 itself
+// and returns false if the request can't go on
+func (cfg *apiConfig) authorize(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+	var err error
+	var errorMsg string
+
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		bearerToken, bearerErr := auth.GetBearerToken(r.Header)
+		if bearerErr != nil {
+			errorMsg = fmt.Sprintf("authorization error: %v", bearerErr)
+			log.Print(errorMsg)
+			respondWithError(w, http.StatusUnauthorized, errorMsg)
+			return uuid.UUID{}, false
+		}
+		if !strings.HasPrefix(bearerToken, auth.APIKeyPrefix) {
+			return cfg.authorizeAccessToken(w, bearerToken, scope)
+		}
+		key = bearerToken
+	}
+
+	dbKey, err := cfg.dbQueries.UseAPIKey(r.Context(), auth.HashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = "api key is invalid, expired or revoked"
+		log.Print(errorMsg)
+		respondWithError(w, http.StatusUnauthorized, errorMsg)
+		return uuid.UUID{}, false
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not check api key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return uuid.UUID{}, false
+	}
+	if !auth.HasScope(dbKey.Scopes, scope) {
+		respondWithMissingScope(w, scope)
+		return uuid.UUID{}, false
+	}
+
+	return dbKey.UserID, true
+}
+
+func (cfg *apiConfig) authorizeAccessToken(w http.ResponseWriter, bearerToken, scope string) (uuid.UUID, bool) {
+	claims, err := cfg.signer.ValidateAccessToken(bearerToken)
+	if err != nil {
+		errorMsg := fmt.Sprintf("token included but invalid: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, http.StatusUnauthorized, errorMsg)
+		return uuid.UUID{}, false
+	}
+	if !claims.HasScope(scope) {
+		respondWithMissingScope(w, scope)
+		return uuid.UUID{}, false
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		errorMsg := fmt.Sprintf("token included but invalid: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, http.StatusUnauthorized, errorMsg)
+		return uuid.UUID{}, false
+	}
+	return userID, true
+}
+
+// the scope is named so clients know what to ask for, it goes in the
+// WWW-Authenticate header too like RFC 6750 says
+func respondWithMissingScope(w http.ResponseWriter, scope string) {
+	errorMsg := fmt.Sprintf("missing required scope: %s", scope)
+	log.Print(errorMsg)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+	respondWithError(w, http.StatusForbidden, errorMsg)
+}
+
+// access tokens carry a snapshot of the user, a change to it (chirpy red,
+// role) shows up in the next token
+func (cfg *apiConfig) makeAccessToken(ctx context.Context, dbUser database.User) (string, error) {
+	return cfg.makeScopedAccessToken(ctx, dbUser, auth.UserScopes, "")
+}
+
+func (cfg *apiConfig) makeScopedAccessToken(ctx context.Context, dbUser database.User, scopes []string, clientID string) (string, error) {
+	role, err := cfg.userRole(ctx, dbUser.ID)
+	if err != nil {
+		return "", err
+	}
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(ctx, dbUser.ID)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.signer.MakeAccessToken(dbUser.ID, jwtDuration, auth.AccessClaims{
+		Scope:       strings.Join(scopes, " "),
+		IsChirpyRed: isChirpyRed,
+		Role:        role,
+		ClientID:    clientID,
+	})
+}
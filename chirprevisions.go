@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/chirps"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// CHIRP_EDIT_WINDOW is how long after a chirp goes out it can still be
+// edited, like "15m". unset means no limit
+func loadEditWindow() (time.Duration, error) {
+	windowStr := os.Getenv("CHIRP_EDIT_WINDOW")
+	if windowStr == "" {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid CHIRP_EDIT_WINDOW %q", windowStr)
+	}
+	return window, nil
+}
+
+type ChirpRevision struct {
+	Revision   int32     `json:"revision"`
+	Body       string    `json:"body"`
+	WrittenAt  time.Time `json:"written_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// PUT /api/chirps/{chirpID} {"body": "..."}, the old body is kept as a
+// revision
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	dbChirp, ok := cfg.authorChirp(w, r)
+	if !ok {
+		return
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(r.Context(), dbChirp.UserID.UUID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find user: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	entitlement, ok := cfg.entitlements(w, r, isChirpyRed)
+	if !ok {
+		return
+	}
+	if !entitlement.CanEdit {
+		errorMsg = fmt.Sprintf("%s accounts can't edit chirps", entitlement.Tier)
+		log.Print(errorMsg)
+		respondWithError(w, 403, errorMsg)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	body, flagged, ok := cfg.validateChirpBody(w, r, params.Body, entitlement)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// everything below goes by the locked row, it may have been deleted or
+	// edited since authorChirp read it. the lock also gives two edits at once
+	// consecutive revision numbers
+	dbChirp, err = qtx.LockChirp(r.Context(), dbChirp.ID)
+	if err == nil && dbChirp.DeletedAt.Valid {
+		err = errors.New("chirp was deleted")
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find chirp in db: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+	if !chirps.EditWindowOpen(chirpFromDB(dbChirp).postedAt(), cfg.editWindow, time.Now()) {
+		errorMsg = fmt.Sprintf("chirps can only be edited for %v after posting", cfg.editWindow)
+		log.Print(errorMsg)
+		respondWithError(w, 403, errorMsg)
+		return
+	}
+
+	if err = qtx.CreateChirpRevision(r.Context(), dbChirp.ID); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not save revision: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	dbChirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:           dbChirp.ID,
+		Body:         body,
+		FlaggedWords: flagged,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not update chirp: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit edit: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = respondWithJSON(w, 200, chirpFromDB(dbChirp)); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// GET /api/chirps/{chirpID}/revisions, every earlier version, oldest first.
+// public like the chirp itself
+func (cfg *apiConfig) listChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if _, err = cfg.dbQueries.GetChirp(r.Context(), chirpID); err != nil {
+		errorMsg = fmt.Sprintf("could not find id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	dbRevisions, err := cfg.dbQueries.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get revisions: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			Revision:   dbRevision.Revision,
+			Body:       dbRevision.Body,
+			WrittenAt:  dbRevision.WrittenAt,
+			ReplacedAt: dbRevision.ReplacedAt,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, revisions); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
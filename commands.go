@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/Curator4/chirpy/internal/database"
+)
+
+// one-off admin tasks, run as "chirpy <command> [args]" against the same
+// database the server uses
+func runCommand(db *sql.DB, q *database.Queries, args []string) error {
+	ctx := context.Background()
+
+	switch args[0] {
+	case "make-admin":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: chirpy make-admin <email>")
+		}
+		return makeAdmin(ctx, q, args[1])
+	case "reconcile-polka":
+		return reconcilePolka(ctx, db, q, args[1:], os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q, commands: make-admin, reconcile-polka", args[0])
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// rows of the entitlements table, a user is on red while their subscription
+// is, see applyPolkaEvent
+const (
+	tierFree = "free"
+	tierRed  = "red"
+)
+
+type Entitlements struct {
+	Tier               string    `json:"tier"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	MaxChirpLength     int32     `json:"max_chirp_length"`
+	ChirpsPerHour      int32     `json:"chirps_per_hour"`
+	MaxScheduledChirps int32     `json:"max_scheduled_chirps"`
+	CanEdit            bool      `json:"can_edit"`
+}
+
+func entitlementsFromDB(dbEntitlement database.Entitlement) Entitlements {
+	return Entitlements{
+		Tier:               dbEntitlement.Tier,
+		UpdatedAt:          dbEntitlement.UpdatedAt,
+		MaxChirpLength:     dbEntitlement.MaxChirpLength,
+		ChirpsPerHour:      dbEntitlement.ChirpsPerHour,
+		MaxScheduledChirps: dbEntitlement.MaxScheduledChirps,
+		CanEdit:            dbEntitlement.CanEdit,
+	}
+}
+
+func entitlementTier(isChirpyRed bool) string {
+	if isChirpyRed {
+		return tierRed
+	}
+	return tierFree
+}
+
+// every limit a handler enforces comes from here, nothing is hardcoded per
+// tier. answers 500 itself
+func (cfg *apiConfig) entitlements(w http.ResponseWriter, r *http.Request, isChirpyRed bool) (database.Entitlement, bool) {
+	entitlement, err := cfg.dbQueries.GetEntitlements(r.Context(), entitlementTier(isChirpyRed))
+	if err != nil {
+		errorMsg := fmt.Sprintf("database error, could not get entitlements: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return database.Entitlement{}, false
+	}
+	return entitlement, true
+}
+
+// answers 429 with Retry-After and returns true if the user posted their
+// hourly allowance already. scheduled chirps count when they are written
+func (cfg *apiConfig) rejectChirpRateLimit(w http.ResponseWriter, r *http.Request, userID uuid.UUID, entitlement database.Entitlement) bool {
+	now := time.Now()
+	recent, err := cfg.dbQueries.GetRecentChirpCount(r.Context(), database.GetRecentChirpCountParams{
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Since:  now.Add(-time.Hour),
+	})
+	if err != nil {
+		// fails open, same as the login throttle
+		log.Printf("could not count recent chirps for %v: %v", userID, err)
+		return false
+	}
+	if recent.Chirps < int64(entitlement.ChirpsPerHour) {
+		return false
+	}
+
+	seconds := max(1, int(math.Ceil(recent.Oldest.Add(time.Hour).Sub(now).Seconds())))
+	errorMsg := fmt.Sprintf("%s accounts can post %d chirps an hour, try again in %d seconds", entitlement.Tier, entitlement.ChirpsPerHour, seconds)
+	log.Printf("rate limited chirps for user %v", userID)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, errorMsg)
+	return true
+}
+
+// GET /api/entitlements, what each tier gets, for upgrade pages
+func (cfg *apiConfig) listEntitlements(w http.ResponseWriter, r *http.Request) {
+	dbEntitlements, err := cfg.dbQueries.ListEntitlements(r.Context())
+	if err != nil {
+		errorMsg := fmt.Sprintf("database error, could not list entitlements: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	entitlements := make([]Entitlements, 0, len(dbEntitlements))
+	for _, dbEntitlement := range dbEntitlements {
+		entitlements = append(entitlements, entitlementsFromDB(dbEntitlement))
+	}
+
+	if err = respondWithJSON(w, 200, entitlements); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// PUT /admin/entitlements/{tier}, takes every field, like the table
+func (cfg *apiConfig) updateEntitlements(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		MaxChirpLength     int32 `json:"max_chirp_length"`
+		ChirpsPerHour      int32 `json:"chirps_per_hour"`
+		MaxScheduledChirps int32 `json:"max_scheduled_chirps"`
+		CanEdit            bool  `json:"can_edit"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.MaxChirpLength <= 0 || params.ChirpsPerHour <= 0 || params.MaxScheduledChirps < 0 {
+		errorMsg = "max_chirp_length and chirps_per_hour must be positive, max_scheduled_chirps can't be negative"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	dbEntitlement, err := cfg.dbQueries.UpdateEntitlements(r.Context(), database.UpdateEntitlementsParams{
+		Tier:               r.PathValue("tier"),
+		MaxChirpLength:     params.MaxChirpLength,
+		ChirpsPerHour:      params.ChirpsPerHour,
+		MaxScheduledChirps: params.MaxScheduledChirps,
+		CanEdit:            params.CanEdit,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = fmt.Sprintf("no tier %q, tiers are %s and %s", r.PathValue("tier"), tierFree, tierRed)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not update entitlements: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	log.Printf("user %v updated the %s entitlements", adminUserID(r).UUID, dbEntitlement.Tier)
+	if err = respondWithJSON(w, 200, entitlementsFromDB(dbEntitlement)); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
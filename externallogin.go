@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+// the browser carries the state between the redirect and the callback, so a
+// callback from someone else's login attempt is rejected
+const oidcStateCookie = "chirpy_oidc_state"
+
+const oidcLoginStateDuration = 10 * time.Minute
+
+type Identity struct {
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func (cfg *apiConfig) oidcProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		errorMsg := fmt.Sprintf("unknown login provider %q", r.PathValue("provider"))
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return nil, false
+	}
+	return provider, true
+}
+
+// beginOIDCLogin stores a login state and returns the provider url to send
+// the browser to. linkUserID is set when a logged in user adds a provider
+func (cfg *apiConfig) beginOIDCLogin(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, linkUserID uuid.NullUUID) (string, error) {
+	state, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(codeVerifier))
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(oidcLoginStateDuration)
+	err = cfg.dbQueries.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/" + provider.Name,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// lax so the cookie comes along on the top level redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, nil
+}
+
+// GET /api/auth/{provider}/login, redirects to the provider
+func (cfg *apiConfig) startExternalLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.beginOIDCLogin(w, r, provider, uuid.NullUUID{})
+	if err != nil {
+		errorMsg := fmt.Sprintf("could not start %s login: %v", provider.Name, err)
+		log.Print(errorMsg)
+		respondWithError(w, 502, errorMsg)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// POST /api/auth/{provider}/link, the client sends the browser to
+// authorization_url. a plain redirect wouldn't carry the access token
+func (cfg *apiConfig) startExternalLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.beginOIDCLogin(w, r, provider, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorMsg := fmt.Sprintf("could not start %s link: %v", provider.Name, err)
+		log.Print(errorMsg)
+		respondWithError(w, 502, errorMsg)
+		return
+	}
+
+	response := struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}{authURL}
+	if err = respondWithJSON(w, 200, response); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// GET /api/auth/{provider}/callback?code=...&state=...
+func (cfg *apiConfig) externalLoginCallback(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	// single use either way
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/" + provider.Name,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		errorMsg = fmt.Sprintf("%s login failed: %s %s", provider.Name, providerErr, query.Get("error_description"))
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		errorMsg = "login state does not match this browser"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	loginState, err := cfg.dbQueries.UseOIDCLoginState(r.Context(), database.UseOIDCLoginStateParams{
+		StateHash: auth.HashToken(state),
+		Provider:  provider.Name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = "login state expired or already used, start over"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get login state: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		errorMsg = fmt.Sprintf("%s login failed: %v", provider.Name, err)
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	if loginState.LinkUserID.Valid {
+		cfg.linkIdentity(w, r, provider.Name, idToken, loginState.LinkUserID.UUID)
+		return
+	}
+
+	dbUser, status, err := cfg.externalLoginUser(r.Context(), provider.Name, idToken)
+	if err != nil {
+		errorMsg = err.Error()
+		log.Print(errorMsg)
+		respondWithError(w, status, errorMsg)
+		return
+	}
+
+	log.Printf("user %v logged in with %s", dbUser.ID, provider.Name)
+	cfg.finishLogin(w, r, dbUser)
+}
+
+// externalLoginUser finds or creates the account for an identity. an existing
+// account is only taken over by email when both sides have verified it,
+// otherwise whoever registers an address at the provider gets the account
+func (cfg *apiConfig) externalLoginUser(ctx context.Context, providerName string, idToken *oidc.IDToken) (database.User, int, error) {
+	identity, err := cfg.dbQueries.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+	})
+	if err == nil {
+		err = cfg.dbQueries.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			Provider: providerName,
+			Subject:  idToken.Subject,
+			Email:    idToken.Email,
+		})
+		if err != nil {
+			return database.User{}, 500, fmt.Errorf("database error, could not update identity: %v", err)
+		}
+		dbUser, err := cfg.dbQueries.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return database.User{}, 500, fmt.Errorf("database error, could not get user: %v", err)
+		}
+		return dbUser, 200, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, 500, fmt.Errorf("database error, could not get identity: %v", err)
+	}
+
+	if idToken.Email == "" {
+		return database.User{}, 400, fmt.Errorf("%s did not share an email address, it is needed for an account", providerName)
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, 500, fmt.Errorf("database error, could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	dbUser, err := qtx.GetUserByEmail(ctx, idToken.Email)
+	newUser := errors.Is(err, sql.ErrNoRows)
+	switch {
+	case newUser:
+		// no password to log in with, the user can set one with a reset
+		placeholder, err := auth.MakeOpaqueToken()
+		if err != nil {
+			return database.User{}, 500, fmt.Errorf("error generating password: %v", err)
+		}
+		hashedPassword, err := auth.HashPassword(placeholder)
+		if err != nil {
+			return database.User{}, 500, fmt.Errorf("could not hash password: %v", err)
+		}
+		dbUser, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email:          idToken.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return database.User{}, 500, fmt.Errorf("database error, could not create user: %v", err)
+		}
+		if idToken.EmailVerified {
+			dbUser, err = qtx.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+				ID:    dbUser.ID,
+				Email: dbUser.Email,
+			})
+			if err != nil {
+				return database.User{}, 500, fmt.Errorf("database error, could not verify email: %v", err)
+			}
+		}
+	case err != nil:
+		return database.User{}, 500, fmt.Errorf("database error, could not get user: %v", err)
+	case !idToken.EmailVerified || !dbUser.EmailVerifiedAt.Valid:
+		return database.User{}, 409, fmt.Errorf("an account with this email exists, log in and link %s from there", providerName)
+	}
+
+	err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+		UserID:   dbUser.ID,
+		Email:    idToken.Email,
+	})
+	if err != nil {
+		return database.User{}, 500, fmt.Errorf("database error, could not link identity: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return database.User{}, 500, fmt.Errorf("database error, could not commit login: %v", err)
+	}
+
+	if newUser && !dbUser.EmailVerifiedAt.Valid {
+		if err = cfg.sendVerificationEmail(ctx, dbUser); err != nil {
+			log.Printf("could not send verification email to %s: %v", dbUser.Email, err)
+		}
+	}
+	return dbUser, 200, nil
+}
+
+func (cfg *apiConfig) linkIdentity(w http.ResponseWriter, r *http.Request, providerName string, idToken *oidc.IDToken, userID uuid.UUID) {
+	var err error
+	var errorMsg string
+
+	identity, err := cfg.dbQueries.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: providerName,
+		Subject:  idToken.Subject,
+	})
+	if err == nil && identity.UserID != userID {
+		errorMsg = fmt.Sprintf("this %s account is linked to another user", providerName)
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
+		return
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorMsg = fmt.Sprintf("database error, could not get identity: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		err = cfg.dbQueries.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+			Provider: providerName,
+			Subject:  idToken.Subject,
+			UserID:   userID,
+			Email:    idToken.Email,
+		})
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not link identity: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		log.Printf("user %v linked %s", userID, providerName)
+	}
+
+	cfg.respondWithIdentities(w, r, userID)
+}
+
+func (cfg *apiConfig) listIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	cfg.respondWithIdentities(w, r, userID)
+}
+
+// DELETE /api/identities/{provider}
+func (cfg *apiConfig) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteUserIdentity(r.Context(), database.DeleteUserIdentityParams{
+		UserID:   userID,
+		Provider: strings.ToLower(r.PathValue("provider")),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not unlink identity: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if deleted == 0 {
+		errorMsg = "no identity linked for that provider"
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) respondWithIdentities(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	dbIdentities, err := cfg.dbQueries.ListUserIdentities(r.Context(), userID)
+	if err != nil {
+		errorMsg := fmt.Sprintf("database error, could not list identities: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	identities := make([]Identity, 0, len(dbIdentities))
+	for _, dbIdentity := range dbIdentities {
+		identities = append(identities, Identity{
+			Provider:    dbIdentity.Provider,
+			Email:       dbIdentity.Email,
+			CreatedAt:   dbIdentity.CreatedAt,
+			LastLoginAt: dbIdentity.LastLoginAt,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, identities); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+func (cfg *apiConfig) purgeOIDCLoginStates(ctx context.Context) error {
+	return cfg.dbQueries.DeleteExpiredOIDCLoginStates(ctx)
+}
@@ -2,60 +2,67 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// password hashing
+// password hashing. PasswordParams is what new hashes use, main sets it from
+// config at startup. stored hashes keep whatever they were made with until
+// NeedsRehash says otherwise
+var PasswordParams = argon2id.DefaultParams
+
 func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, argon2id.DefaultParams)
+	return argon2id.CreateHash(password, PasswordParams)
 }
 
+// CheckPasswordHash also takes bcrypt hashes, for users imported from
+// somewhere else. they get upgraded to argon2id on their next login
 func CheckPasswordHash(password, hash string) (bool, error) {
+	if isBcryptHash(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-// JWTs
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
+// NeedsRehash reports whether a stored hash is weaker than PasswordParams.
+// parallelism is left out, it changes the output but not the cost, and the
+// default depends on how many cpus the machine that made the hash had
+func NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		return true
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	signedString, err := token.SignedString([]byte(tokenSecret))
+	params, _, _, err := argon2id.DecodeHash(hash)
 	if err != nil {
-		return "", err
+		return false
 	}
-
-	return signedString, nil
+	return params.Memory < PasswordParams.Memory ||
+		params.Iterations < PasswordParams.Iterations ||
+		params.SaltLength < PasswordParams.SaltLength ||
+		params.KeyLength < PasswordParams.KeyLength
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	keyFunc := func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	}
-
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, keyFunc)
-	if err != nil {
-		return uuid.UUID{}, err
-	}
-
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.UUID{}, err
+// IsSupportedPasswordHash checks a hash before it is imported
+func IsSupportedPasswordHash(hash string) bool {
+	if isBcryptHash(hash) {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err == nil
 	}
+	_, _, _, err := argon2id.DecodeHash(hash)
+	return err == nil
+}
 
-	return uuid.Parse(userIDString)
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -76,6 +83,12 @@ func GetBearerToken(headers http.Header) (string, error) {
 
 // refresh tokens
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// random hex token, for anything that is looked up in the database rather
+// than signed (refresh tokens, password resets)
+func MakeOpaqueToken() (string, error) {
 	randomBytes := make([]byte, 32)
 	_, err := rand.Read(randomBytes)
 	if err != nil {
@@ -83,11 +96,30 @@ func MakeRefreshToken() (string, error) {
 	}
 	token := hex.EncodeToString(randomBytes)
 	if token == "" {
-		return "", errors.New("faulty refresh token")
+		return "", errors.New("faulty token")
 	}
 	return token, nil
 }
 
+// personal api keys are opaque tokens with a recognisable prefix, so a leaked
+// one is easy to grep for
+const APIKeyPrefix = "chirpy_"
+
+func MakeAPIKey() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + token, nil
+}
+
+// HashToken is for storing opaque tokens, they are random enough that a plain
+// sha256 does the job, no salt or slow hash needed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // apikey
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
@@ -3,9 +3,8 @@ package auth
 import (
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -50,58 +49,57 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
-func TestMakeAndValidateJWT(t *testing.T) {
-	userID := uuid.New()
-	secret := "blonde-blazer"
-	expiresIn := time.Hour
+func TestNeedsRehash(t *testing.T) {
+	defaultParams := PasswordParams
+	defer func() { PasswordParams = defaultParams }()
 
-	// create
-	tokenString, err := MakeJWT(userID, secret, expiresIn)
+	weak := *defaultParams
+	weak.Memory = 8 * 1024
+	PasswordParams = &weak
+	weakHash, err := HashPassword("mechaman")
 	if err != nil {
-		t.Fatalf("MakeJWT failed %v", err)
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	if NeedsRehash(weakHash) {
+		t.Error("Expected hash with current params to not need a rehash")
 	}
 
-	// validate
-	validatedID, err := ValidateJWT(tokenString, secret)
-	if err != nil {
-		t.Errorf("ValidateJWT failed %v", err)
+	PasswordParams = defaultParams
+	if !NeedsRehash(weakHash) {
+		t.Error("Expected hash with less memory to need a rehash")
 	}
 
-	// ensure they match
-	if validatedID != userID {
-		t.Errorf("expected user ID %v, got %v", userID, validatedID)
+	// old hashes still check out after the params went up
+	match, err := CheckPasswordHash("mechaman", weakHash)
+	if err != nil || !match {
+		t.Errorf("Expected old hash to still match: %v", err)
 	}
 }
 
-func TestValidateJWT_Expired(t *testing.T) {
-	userID := uuid.New()
-	secret := "mechaman"
-	expiresIn := -time.Hour
-
-	tokenString, err := MakeJWT(userID, secret, expiresIn)
+func TestCheckPasswordHash_Bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("mechaman"), bcrypt.MinCost)
 	if err != nil {
-		t.Fatalf("MakeJWT failed %v", err)
+		t.Fatalf("bcrypt failed: %v", err)
 	}
 
-	_, err = ValidateJWT(tokenString, secret)
-	if err == nil {
-		t.Error("Expected expired token to be rejected")
+	if !IsSupportedPasswordHash(string(hash)) {
+		t.Error("Expected bcrypt hash to be supported")
+	}
+	if !NeedsRehash(string(hash)) {
+		t.Error("Expected bcrypt hash to need a rehash")
 	}
-}
-
-func TestValidateJWT_WrongSecret(t *testing.T) {
-	userID := uuid.New()
-	secret := "blonde-blazer"
-	expiresIn := time.Hour
 
-	tokenString, err := MakeJWT(userID, secret, expiresIn)
-	if err != nil {
-		t.Fatalf("makeJWT failed %v", err)
+	match, err := CheckPasswordHash("mechaman", string(hash))
+	if err != nil || !match {
+		t.Errorf("Expected bcrypt password to match: %v", err)
+	}
+	match, err = CheckPasswordHash("mechaboy", string(hash))
+	if err != nil || match {
+		t.Errorf("Expected wrong bcrypt password to not match: %v", err)
 	}
 
-	_, err = ValidateJWT(tokenString, "bronze-blazer")
-	if err == nil {
-		t.Error("Expected token with wrong secret to be rejected")
+	if IsSupportedPasswordHash("plaintext") {
+		t.Error("Expected garbage hash to be rejected")
 	}
 }
 
@@ -159,3 +157,26 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken failed: %v", err)
+	}
+
+	hash := HashToken(token)
+	if hash == token {
+		t.Error("Hash should not equal plain token")
+	}
+	if hash != HashToken(token) {
+		t.Error("Expected hashing to be deterministic")
+	}
+
+	other, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken failed: %v", err)
+	}
+	if HashToken(other) == hash {
+		t.Error("Expected different tokens to hash differently")
+	}
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Keyring holds every JWT key chirpy knows about. exactly one key signs new
+// tokens, the rest only verify until their retire time passes, so rotating
+// doesn't log anyone out as long as the old key outlives its tokens
+type Keyring struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]keyringEntry
+}
+
+type keyringEntry struct {
+	key      *Key
+	addedAt  time.Time
+	retireAt time.Time // zero means never
+}
+
+// KeyInfo is the public view of a keyring entry, for the admin api
+type KeyInfo struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Active    bool       `json:"active"`
+	AddedAt   time.Time  `json:"added_at"`
+	RetireAt  *time.Time `json:"retire_at,omitempty"`
+}
+
+func NewKeyring(active *Key) (*Keyring, error) {
+	if active == nil || !active.CanSign() {
+		return nil, errors.New("active key must be able to sign")
+	}
+	return &Keyring{
+		active: active,
+		keys: map[string]keyringEntry{
+			active.ID: {key: active, addedAt: time.Now()},
+		},
+	}, nil
+}
+
+// AddVerifyKey adds a key that is accepted until retireAt, zero for never
+func (kr *Keyring) AddVerifyKey(key *Key, retireAt time.Time) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, exists := kr.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	kr.keys[key.ID] = keyringEntry{key: key, addedAt: time.Now(), retireAt: retireAt}
+	return nil
+}
+
+// Rotate makes newKey the signing key. the previous signing key keeps
+// verifying until retireOldAt
+func (kr *Keyring) Rotate(newKey *Key, retireOldAt time.Time) error {
+	if newKey == nil || !newKey.CanSign() {
+		return errors.New("new active key must be able to sign")
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, exists := kr.keys[newKey.ID]; exists {
+		return fmt.Errorf("duplicate key id %q", newKey.ID)
+	}
+
+	old := kr.keys[kr.active.ID]
+	old.retireAt = retireOldAt
+	kr.keys[kr.active.ID] = old
+
+	kr.keys[newKey.ID] = keyringEntry{key: newKey, addedAt: time.Now()}
+	kr.active = newKey
+	return nil
+}
+
+// ScheduledKey is a signing key that takes over from the one before it at
+// ActivateAt
+type ScheduledKey struct {
+	Key        *Key
+	ActivateAt time.Time
+}
+
+// Schedule makes the keyring follow a rotation schedule, so instances that
+// share one agree on the keys without talking to each other. the last key
+// that has activated signs. earlier keys verify until the key after them has
+// been active for grace. keys that haven't activated yet already verify, so
+// once one starts signing its tokens validate everywhere that has synced
+// since it was scheduled. keys not in the schedule are left alone
+func (kr *Keyring) Schedule(keys []ScheduledKey, grace time.Duration, now time.Time) error {
+	keys = slices.Clone(keys)
+	slices.SortStableFunc(keys, func(a, b ScheduledKey) int { return a.ActivateAt.Compare(b.ActivateAt) })
+
+	active := -1
+	for i, scheduled := range keys {
+		if !scheduled.Key.CanSign() {
+			return fmt.Errorf("scheduled key %q must be able to sign", scheduled.Key.ID)
+		}
+		if !scheduled.ActivateAt.After(now) {
+			active = i
+		}
+	}
+	if active < 0 {
+		return errors.New("no scheduled key has activated yet")
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	for i, scheduled := range keys {
+		var retireAt time.Time
+		if i < active {
+			retireAt = keys[i+1].ActivateAt.Add(grace)
+		}
+		entry, exists := kr.keys[scheduled.Key.ID]
+		if !exists {
+			// already pruned, don't bring it back
+			if !retireAt.IsZero() && !now.Before(retireAt) {
+				continue
+			}
+			entry = keyringEntry{addedAt: now}
+		}
+		entry.key = scheduled.Key
+		entry.retireAt = retireAt
+		kr.keys[scheduled.Key.ID] = entry
+	}
+	kr.active = keys[active].Key
+	return nil
+}
+
+// Prune drops keys whose retire time has passed and returns their ids
+func (kr *Keyring) Prune(now time.Time) []string {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	var pruned []string
+	for kid, entry := range kr.keys {
+		if entry.key != kr.active && entry.retired(now) {
+			delete(kr.keys, kid)
+			pruned = append(pruned, kid)
+		}
+	}
+	sort.Strings(pruned)
+	return pruned
+}
+
+func (kr *Keyring) Active() *Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active
+}
+
+// Lookup ignores retired keys even before Prune gets to them
+func (kr *Keyring) Lookup(kid string) (*Key, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	entry, ok := kr.keys[kid]
+	if !ok || entry.retired(time.Now()) {
+		return nil, false
+	}
+	return entry.key, true
+}
+
+func (kr *Keyring) Keys() []KeyInfo {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(kr.keys))
+	for _, entry := range kr.keys {
+		info := KeyInfo{
+			ID:        entry.key.ID,
+			Algorithm: entry.key.Method.Alg(),
+			Active:    entry.key == kr.active,
+			AddedAt:   entry.addedAt,
+		}
+		if !entry.retireAt.IsZero() {
+			retireAt := entry.retireAt
+			info.RetireAt = &retireAt
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].AddedAt.Before(infos[j].AddedAt) })
+	return infos
+}
+
+func (kr *Keyring) verifyKeys() []*Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*Key, 0, len(kr.keys))
+	for _, entry := range kr.keys {
+		if !entry.retired(now) {
+			keys = append(keys, entry.key)
+		}
+	}
+	return keys
+}
+
+func (e keyringEntry) retired(now time.Time) bool {
+	return !e.retireAt.IsZero() && !now.Before(e.retireAt)
+}
+
+// GenerateKey makes a fresh signing key, alg is "EdDSA" or "RS256"
+func GenerateKey(id, alg string) (*Key, error) {
+	switch alg {
+	case "", "EdDSA":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Key(id, privateKey), nil
+	case "RS256":
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAKey(id, privateKey), nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringRotate(t *testing.T) {
+	oldKey, err := GenerateKey("old", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	newKey, err := GenerateKey("new", "RS256")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	keyring, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	signer := NewSignerFromKeyring(keyring)
+
+	oldToken, err := signer.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+
+	if err = keyring.Rotate(newKey, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if keyring.Active() != newKey {
+		t.Error("expected new key to be active after rotation")
+	}
+
+	// tokens from before the rotation still validate
+	if _, err = signer.ValidateJWT(oldToken); err != nil {
+		t.Errorf("expected token signed by retiring key to validate: %v", err)
+	}
+
+	newToken, err := signer.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(newToken); err != nil {
+		t.Errorf("expected token signed by new key to validate: %v", err)
+	}
+
+	if len(signer.JWKS().Keys) != 2 {
+		t.Errorf("expected both keys in JWKS during the grace period")
+	}
+}
+
+func TestKeyringRetiredKeys(t *testing.T) {
+	oldKey, err := GenerateKey("old", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	newKey, err := GenerateKey("new", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	keyring, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	signer := NewSignerFromKeyring(keyring)
+
+	oldToken, err := signer.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+
+	// retire immediately
+	if err = keyring.Rotate(newKey, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(oldToken); err == nil {
+		t.Error("expected token signed by retired key to be rejected")
+	}
+
+	pruned := keyring.Prune(time.Now())
+	if len(pruned) != 1 || pruned[0] != "old" {
+		t.Errorf("expected old key to be pruned, got %v", pruned)
+	}
+	if len(keyring.Keys()) != 1 {
+		t.Errorf("expected only the active key left, got %v", keyring.Keys())
+	}
+}
+
+func TestKeyringDuplicateKeyID(t *testing.T) {
+	key, err := GenerateKey("same", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	keyring, err := NewKeyring(key)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	other, err := GenerateKey("same", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if err = keyring.Rotate(other, time.Now()); err == nil {
+		t.Error("expected rotation to a duplicate kid to fail")
+	}
+}
+
+func TestKeyringSchedule(t *testing.T) {
+	configKey, err := GenerateKey("config", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	nextKey, err := GenerateKey("next", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	keyring, err := NewKeyring(configKey)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	now := time.Now()
+	activateAt := now.Add(time.Minute)
+	schedule := []ScheduledKey{
+		{Key: nextKey, ActivateAt: activateAt},
+		{Key: configKey},
+	}
+
+	// scheduled but not active yet, it verifies and the old key still signs
+	if err = keyring.Schedule(schedule, time.Hour, now); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if keyring.Active() != configKey {
+		t.Error("expected the config key to sign until the next one activates")
+	}
+	if _, ok := keyring.Lookup("next"); !ok {
+		t.Error("expected the pending key to verify already")
+	}
+
+	// after activation the old key verifies for the grace period
+	if err = keyring.Schedule(schedule, time.Hour, activateAt); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if keyring.Active() != nextKey {
+		t.Error("expected the next key to sign once it activated")
+	}
+	for _, info := range keyring.Keys() {
+		if info.ID == "config" && (info.RetireAt == nil || !info.RetireAt.Equal(activateAt.Add(time.Hour))) {
+			t.Errorf("expected the config key to retire an hour after the switch, got %v", info.RetireAt)
+		}
+	}
+
+	// once pruned, syncing the same schedule doesn't bring it back
+	later := activateAt.Add(2 * time.Hour)
+	keyring.Prune(later)
+	if err = keyring.Schedule(schedule, time.Hour, later); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if len(keyring.Keys()) != 1 {
+		t.Errorf("expected only the next key left, got %v", keyring.Keys())
+	}
+}
+
+func TestKeyringScheduleNothingActive(t *testing.T) {
+	key, err := GenerateKey("key", "EdDSA")
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	keyring, err := NewKeyring(key)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	now := time.Now()
+	if err = keyring.Schedule([]ScheduledKey{{Key: key, ActivateAt: now.Add(time.Minute)}}, time.Hour, now); err == nil {
+		t.Error("expected a schedule without an active key to fail")
+	}
+	if err = keyring.Schedule([]ScheduledKey{{Key: &Key{ID: "public"}}}, time.Hour, now); err == nil {
+		t.Error("expected a verify only key in the schedule to fail")
+	}
+}
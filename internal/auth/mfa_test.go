@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RFC 6238 appendix B, SHA1 secret "12345678901234567890", last 6 digits
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if code != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, code, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret failed: %v", err)
+	}
+	now := time.Now()
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode failed: %v", err)
+	}
+	step, ok, err := ValidateTOTP(secret, code, now)
+	if err != nil || !ok {
+		t.Fatalf("expected current code to validate, got %v %v", ok, err)
+	}
+	if step != now.Unix()/30 {
+		t.Errorf("expected step %d, got %d", now.Unix()/30, step)
+	}
+
+	// one step of drift is fine
+	if _, ok, _ = ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok {
+		t.Error("expected code from previous step to validate")
+	}
+
+	// five minutes is not
+	if _, ok, _ = ValidateTOTP(secret, code, now.Add(5*time.Minute)); ok {
+		t.Error("expected old code to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes failed: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate recovery code %s", code)
+		}
+		seen[code] = true
+	}
+
+	if NormalizeRecoveryCode(" ABCDE-FGHIJ ") != NormalizeRecoveryCode("abcdefghij") {
+		t.Error("expected normalization to ignore case, dashes and spaces")
+	}
+}
+
+func TestMFAChallengeToken(t *testing.T) {
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("blonde-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := signer.MakeMFAChallengeToken(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAChallengeToken failed: %v", err)
+	}
+
+	gotID, err := signer.ValidateMFAChallengeToken(token)
+	if err != nil || gotID != userID {
+		t.Errorf("expected %v, got %v (%v)", userID, gotID, err)
+	}
+
+	if _, err = signer.ValidateJWT(token); err == nil {
+		t.Error("expected challenge token to be rejected as access token")
+	}
+}
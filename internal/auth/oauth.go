@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DelegatedScopes is what an api key or a third party oauth client may be
+// given, changing the account itself or admin work takes a real login
+var DelegatedScopes = []string{ScopeChirpsRead, ScopeChirpsWrite}
+
+// ParseScope splits an OAuth2 scope parameter, dropping duplicates
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// VerifyPKCE checks an RFC 7636 S256 code verifier against the challenge sent
+// with the authorization request. the plain method isn't supported, it only
+// exists for clients that can't hash
+func VerifyPKCE(verifier, challenge string) bool {
+	if !validPKCEString(verifier) || !validPKCEString(challenge) {
+		return false
+	}
+	expected := PKCEChallenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// PKCEChallenge is the S256 challenge for a verifier, for when chirpy is the
+// client
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidCodeChallenge is the shape of an S256 challenge, 43 base64url chars
+func ValidCodeChallenge(challenge string) bool {
+	return len(challenge) == 43 && validPKCEString(challenge)
+}
+
+// 43-128 chars from the unreserved set, RFC 7636 section 4.1
+func validPKCEString(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidRedirectURI is what a client may register: an absolute https url, or
+// http on a loopback address for native apps. no fragments
+func ValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		if u.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
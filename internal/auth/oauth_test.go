@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !ValidCodeChallenge(challenge) {
+		t.Error("expected challenge to be valid")
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("expected verifier to match challenge")
+	}
+	if VerifyPKCE(strings.Replace(verifier, "d", "e", 1), challenge) {
+		t.Error("expected other verifier to not match")
+	}
+	if VerifyPKCE("too-short", challenge) {
+		t.Error("expected short verifier to be rejected")
+	}
+	// plain method, verifier == challenge
+	if VerifyPKCE(verifier, verifier) {
+		t.Error("expected plain challenge to be rejected")
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://partner.example/callback", true},
+		{"http://127.0.0.1:8765/callback", true},
+		{"http://localhost/callback", true},
+		{"http://partner.example/callback", false},
+		{"https://partner.example/callback#frag", false},
+		{"/callback", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := ValidRedirectURI(tt.uri); got != tt.want {
+				t.Errorf("ValidRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	got := ParseScope(" chirps:read  chirps:write chirps:read ")
+	if strings.Join(got, " ") != "chirps:read chirps:write" {
+		t.Errorf("unexpected scopes %v", got)
+	}
+}
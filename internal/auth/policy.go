@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is checked whenever a password is set. Breached is optional
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinEntropyBits float64
+	Breached       BreachedPasswords
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      1024,
+	MinEntropyBits: 30,
+}
+
+// PolicyViolation is one failed rule, Rule is stable for clients to match on
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password rejected: " + strings.Join(rules, ", ")
+}
+
+// Check returns a *PasswordPolicyError listing every rule the password breaks,
+// any other error means the breached list couldn't be read. userInputs are
+// things like the email address that shouldn't show up in the password
+func (p PasswordPolicy) Check(password string, userInputs ...string) error {
+	var violations []PolicyViolation
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    "max_length",
+			Message: fmt.Sprintf("password must be at most %d characters", p.MaxLength),
+		})
+	}
+	if bits := EstimateEntropy(password); bits < p.MinEntropyBits {
+		violations = append(violations, PolicyViolation{
+			Rule:    "entropy",
+			Message: fmt.Sprintf("password is too predictable (%.0f bits, need %.0f)", bits, p.MinEntropyBits),
+		})
+	}
+
+	lowerPassword := strings.ToLower(password)
+	for _, input := range userInputs {
+		// for emails only the part before the @ matters
+		input, _, _ = strings.Cut(strings.ToLower(input), "@")
+		if len(input) >= 3 && strings.Contains(lowerPassword, input) {
+			violations = append(violations, PolicyViolation{
+				Rule:    "contains_user_info",
+				Message: "password must not contain your email address",
+			})
+			break
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Rule:    "breached",
+				Message: "password appears in a known data breach",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// EstimateEntropy is a rough guess at how many bits of guessing a password
+// takes: each character is worth log2 of the alphabet the password draws
+// from, repeated characters half that, and continuing a run like "aaa" or
+// "abc" / "321" just one bit
+func EstimateEntropy(password string) float64 {
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{hasLower, 26}, {hasUpper, 26}, {hasDigit, 10}, {hasSymbol, 33}, {hasOther, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	bitsPerChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev rune
+	seen := map[rune]bool{}
+	for i, r := range password {
+		diff := r - prev
+		switch {
+		case i > 0 && (diff == 0 || diff == 1 || diff == -1):
+			bits++
+		case seen[r]:
+			bits += bitsPerChar / 2
+		default:
+			bits += bitsPerChar
+		}
+		seen[r] = true
+		prev = r
+	}
+	return bits
+}
+
+// BreachedPasswords answers whether a password is in a breach corpus
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// LoadBreachedPasswords takes either a file of full SHA-1 hashes, one
+// "HASH[:COUNT]" per line, which is loaded into memory, or a directory in the
+// k-anonymity range layout (one file per 5 char hash prefix holding
+// "SUFFIX:COUNT" lines, like the HIBP downloader makes), which is read lazily
+// one prefix file per lookup so the corpus can be as big as the disk
+func LoadBreachedPasswords(path string) (BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return breachedPrefixDir{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := breachedHashSet{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != 40 {
+			continue
+		}
+		var sum [sha1.Size]byte
+		if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+			continue
+		}
+		hashes[sum] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+type breachedHashSet map[[sha1.Size]byte]struct{}
+
+func (s breachedHashSet) Contains(password string) (bool, error) {
+	_, ok := s[sha1.Sum([]byte(password))]
+	return ok, nil
+}
+
+type breachedPrefixDir struct {
+	dir string
+}
+
+func (d breachedPrefixDir) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(d.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// padded responses list fake suffixes with a count of 0
+		if strings.EqualFold(lineSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy
+
+	tests := []struct {
+		name      string
+		password  string
+		wantRules []string
+	}{
+		{"fine", "correct-Horse-battery", nil},
+		{"empty", "", []string{"min_length", "entropy"}},
+		{"short", "Ab1!", []string{"min_length", "entropy"}},
+		{"repetitive", "aaaaaaaaaaaa", []string{"entropy"}},
+		{"sequence", "abcdefghijkl", []string{"entropy"}},
+		{"contains email", "mechaman-Blonde-Blazer", []string{"contains_user_info"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "mechaman@chirpy.dev")
+			if tt.wantRules == nil {
+				if err != nil {
+					t.Errorf("expected password to pass, got %v", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected *PasswordPolicyError, got %v", err)
+			}
+			var gotRules []string
+			for _, v := range policyErr.Violations {
+				gotRules = append(gotRules, v.Rule)
+			}
+			if strings.Join(gotRules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("expected rules %v, got %v", tt.wantRules, gotRules)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordsFile(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2-hunter2"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := strings.ToUpper(hex.EncodeToString(sum[:])) + ":1234\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords failed: %v", err)
+	}
+	assertBreached(t, breached)
+}
+
+func TestBreachedPasswordsPrefixDir(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2-hunter2"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	dir := t.TempDir()
+	content := hash[5:] + ":1234\n" + strings.Repeat("0", 35) + ":0\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]), []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	breached, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords failed: %v", err)
+	}
+	assertBreached(t, breached)
+}
+
+func assertBreached(t *testing.T, breached BreachedPasswords) {
+	t.Helper()
+
+	found, err := breached.Contains("hunter2-hunter2")
+	if err != nil || !found {
+		t.Errorf("expected breached password to be found: %v", err)
+	}
+	found, err = breached.Contains("correct-Horse-battery")
+	if err != nil || found {
+		t.Errorf("expected other password to not be found: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy
+	policy.Breached = breached
+	var policyErr *PasswordPolicyError
+	if err = policy.Check("hunter2-hunter2"); !errors.As(err, &policyErr) || policyErr.Violations[0].Rule != "breached" {
+		t.Errorf("expected breached violation, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import "slices"
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles from least to most powerful, each one can do what the ones before it
+// can. every account is a RoleUser without it being granted
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// HighestRole picks the most powerful of the granted roles, unknown ones are
+// ignored
+func HighestRole(granted []string) string {
+	highest := RoleUser
+	for _, role := range granted {
+		if slices.Index(Roles, role) > slices.Index(Roles, highest) {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// RoleAtLeast reports whether role can do what min can
+func RoleAtLeast(role, min string) bool {
+	minRank := slices.Index(Roles, min)
+	return minRank >= 0 && slices.Index(Roles, role) >= minRank
+}
@@ -0,0 +1,36 @@
+package auth
+
+import "testing"
+
+func TestHighestRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		want    string
+	}{
+		{"none", nil, RoleUser},
+		{"moderator", []string{RoleModerator}, RoleModerator},
+		{"both", []string{RoleAdmin, RoleModerator}, RoleAdmin},
+		{"unknown", []string{"superuser"}, RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighestRole(tt.granted); got != tt.want {
+				t.Errorf("HighestRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	if !RoleAtLeast(RoleAdmin, RoleModerator) {
+		t.Error("expected admin to be at least moderator")
+	}
+	if RoleAtLeast(RoleModerator, RoleAdmin) {
+		t.Error("expected moderator to not be at least admin")
+	}
+	if RoleAtLeast(RoleAdmin, "superuser") {
+		t.Error("expected unknown role to never be met")
+	}
+}
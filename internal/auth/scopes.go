@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// scopes limit what a credential may do. access tokens carry them in the
+// scope claim, api keys carry the ones they were created with
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	// the account itself: email, password, sessions, 2fa, api keys
+	ScopeUsersWrite = "users:write"
+	// using whatever role the account has, see RoleAtLeast
+	ScopeAdmin = "admin"
+)
+
+// UserScopes is what logging in with a password gets
+var UserScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersWrite, ScopeAdmin}
+
+// ValidateScopes rejects an empty list and anything not in allowed
+func ValidateScopes(scopes, allowed []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required, allowed scopes: %v", allowed)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return fmt.Errorf("scope %q is not allowed, allowed scopes: %v", scope, allowed)
+		}
+	}
+	return nil
+}
+
+// HasScope, write implies read
+func HasScope(scopes []string, scope string) bool {
+	if slices.Contains(scopes, scope) {
+		return true
+	}
+	return scope == ScopeChirpsRead && slices.Contains(scopes, ScopeChirpsWrite)
+}
@@ -0,0 +1,35 @@
+package auth
+
+import "testing"
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr bool
+	}{
+		{"read", []string{ScopeChirpsRead}, false},
+		{"read and write", []string{ScopeChirpsRead, ScopeChirpsWrite}, false},
+		{"empty", nil, true},
+		{"unknown", []string{"chirps:admin"}, true},
+		{"not allowed", []string{ScopeUsersWrite}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateScopes(tt.scopes, DelegatedScopes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !HasScope([]string{ScopeChirpsWrite}, ScopeChirpsRead) {
+		t.Error("expected write to imply read")
+	}
+	if HasScope([]string{ScopeChirpsRead}, ScopeChirpsWrite) {
+		t.Error("expected read to not imply write")
+	}
+}
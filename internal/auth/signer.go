@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Key is a single JWT key identified by its kid. verify only keys have no
+// signKey, they are used for tokens signed somewhere else (or by an older key)
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func NewRSAKey(id string, privateKey *rsa.PrivateKey) *Key {
+	key := &Key{
+		Method:    jwt.SigningMethodRS256,
+		signKey:   privateKey,
+		verifyKey: &privateKey.PublicKey,
+	}
+	key.ID = keyIDOrThumbprint(id, key)
+	return key
+}
+
+func NewEd25519Key(id string, privateKey ed25519.PrivateKey) *Key {
+	key := &Key{
+		Method:    jwt.SigningMethodEdDSA,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+	}
+	key.ID = keyIDOrThumbprint(id, key)
+	return key
+}
+
+// ParsePrivateKeyPEM accepts RSA (PKCS1 or PKCS8) and Ed25519 (PKCS8) keys.
+// an empty id falls back to the RFC 7638 thumbprint of the public key
+func ParsePrivateKeyPEM(id string, data []byte) (*Key, error) {
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return NewRSAKey(id, rsaKey), nil
+	}
+	edKey, err := jwt.ParseEdPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, errors.New("unsupported private key, need RSA or Ed25519 PEM")
+	}
+	privateKey, ok := edKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("unsupported private key, need RSA or Ed25519 PEM")
+	}
+	return NewEd25519Key(id, privateKey), nil
+}
+
+// ParsePublicKeyPEM makes a verify only key. a private key PEM works too, only
+// its public half is kept, so a retired signing key file can be reused as is
+func ParsePublicKeyPEM(id string, data []byte) (*Key, error) {
+	key := &Key{}
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key.Method = jwt.SigningMethodRS256
+		key.verifyKey = rsaKey
+	} else if edKey, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key.Method = jwt.SigningMethodEdDSA
+		key.verifyKey = edKey
+	} else if privateKey, err := ParsePrivateKeyPEM(id, data); err == nil {
+		privateKey.signKey = nil
+		return privateKey, nil
+	} else {
+		return nil, errors.New("unsupported public key, need RSA or Ed25519 PEM")
+	}
+	key.ID = keyIDOrThumbprint(id, key)
+	return key, nil
+}
+
+// CanSign reports whether the key has its private half
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// PrivateKeyPEM is the inverse of ParsePrivateKeyPEM, PKCS8 for both RSA and
+// Ed25519. HMAC and verify only keys have nothing to write out
+func (k *Key) PrivateKeyPEM() ([]byte, error) {
+	switch k.signKey.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, errors.New("only RSA and Ed25519 signing keys can be written as PEM")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.signKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK returns the public key in JWK form, false for symmetric keys which must
+// never be published
+func (k *Key) JWK() (JWK, bool) {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// JWK / JWKS as served on /.well-known/jwks.json (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// kid defaults to the RFC 7638 thumbprint, members in lexicographic order
+func keyIDOrThumbprint(id string, key *Key) string {
+	if id != "" {
+		return id
+	}
+	jwk, ok := key.JWK()
+	if !ok {
+		return ""
+	}
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Signer signs tokens with the keyring's active key and verifies them against
+// every live key, picked by the kid header
+type Signer struct {
+	keyring  *Keyring
+	denylist Denylist
+}
+
+// Denylist is consulted on every access token, it has to be fast (in memory)
+type Denylist interface {
+	IsRevoked(jti string, userID uuid.UUID, issuedAt time.Time) bool
+}
+
+func NewSigner(active *Key, verifyKeys ...*Key) (*Signer, error) {
+	keyring, err := NewKeyring(active)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range verifyKeys {
+		if err := keyring.AddVerifyKey(key, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	return NewSignerFromKeyring(keyring), nil
+}
+
+func NewSignerFromKeyring(keyring *Keyring) *Signer {
+	return &Signer{keyring: keyring}
+}
+
+func (s *Signer) Keyring() *Keyring {
+	return s.keyring
+}
+
+// SetDenylist has to happen before the signer is in use
+func (s *Signer) SetDenylist(denylist Denylist) {
+	s.denylist = denylist
+}
+
+// AccessClaims is what an access token carries. Scope is space separated like
+// in OAuth2, IsChirpyRed and Role are a snapshot from when the token was made.
+// ClientID is set on tokens issued to a third party oauth client
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope       string `json:"scope,omitempty"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Role        string `json:"role,omitempty"`
+	ClientID    string `json:"client_id,omitempty"`
+}
+
+// MakeJWT makes an access token with the scopes a normal login gets
+func (s *Signer) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return s.MakeAccessToken(userID, expiresIn, AccessClaims{Scope: strings.Join(UserScopes, " ")})
+}
+
+// MakeAccessToken fills in the registered claims, the caller the rest
+func (s *Signer) MakeAccessToken(userID uuid.UUID, expiresIn time.Duration, claims AccessClaims) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+	return s.sign(claims)
+}
+
+// ValidateJWT is ValidateAccessToken for when only the user matters
+func (s *Signer) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := s.ValidateAccessToken(tokenString)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return claims.UserID()
+}
+
+// ValidateAccessToken only accepts live access tokens: tokens minted for some
+// other purpose (email verification etc) carry an audience and are rejected,
+// and so is anything on the denylist
+func (s *Signer) ValidateAccessToken(tokenString string) (*AccessClaims, error) {
+	claims, err := s.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.denylist != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if s.denylist.IsRevoked(claims.ID, userID, issuedAt) {
+			return nil, errors.New("token has been revoked")
+		}
+	}
+
+	return claims, nil
+}
+
+// ParseAccessToken checks signature, expiry and purpose but not the denylist
+func (s *Signer) ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	if _, err := s.parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) != 0 {
+		return nil, errors.New("not an access token")
+	}
+	// tokens from before scopes existed were all login tokens
+	if claims.Scope == "" {
+		claims.Scope = strings.Join(UserScopes, " ")
+	}
+	return claims, nil
+}
+
+func (c *AccessClaims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+func (c *AccessClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *AccessClaims) HasScope(scope string) bool {
+	return HasScope(c.Scopes(), scope)
+}
+
+func (s *Signer) sign(claims jwt.Claims) (string, error) {
+	active := s.keyring.Active()
+	token := jwt.NewWithClaims(active.Method, claims)
+	token.Header["kid"] = active.ID
+
+	return token.SignedString(active.signKey)
+}
+
+func (s *Signer) parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.keyFunc, options...)
+}
+
+// tokens without a kid predate key ids and are checked against the active key
+func (s *Signer) keyFunc(token *jwt.Token) (any, error) {
+	key := s.keyring.Active()
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = s.keyring.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown or retired key id %q", kid)
+		}
+	}
+	// the alg header is attacker controlled, it has to match the key
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), key.ID)
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS lists the public half of every live asymmetric key
+func (s *Signer) JWKS() JWKS {
+	keys := s.keyring.verifyKeys()
+	jwks := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeys(t *testing.T) (*Key, *Key) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey failed: %v", err)
+	}
+	return NewRSAKey("rsa-1", rsaKey), NewEd25519Key("", edKey)
+}
+
+func TestSignerMakeAndValidateJWT(t *testing.T) {
+	rsaKey, edKey := newTestKeys(t)
+
+	for _, key := range []*Key{rsaKey, edKey, NewHMACKey("hmac", []byte("blonde-blazer"))} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			signer, err := NewSigner(key)
+			if err != nil {
+				t.Fatalf("NewSigner failed: %v", err)
+			}
+
+			userID := uuid.New()
+			tokenString, err := signer.MakeJWT(userID, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT failed: %v", err)
+			}
+
+			validatedID, err := signer.ValidateJWT(tokenString)
+			if err != nil {
+				t.Fatalf("ValidateJWT failed: %v", err)
+			}
+			if validatedID != userID {
+				t.Errorf("expected user ID %v, got %v", userID, validatedID)
+			}
+		})
+	}
+}
+
+func TestSignerRejectsExpiredAndForeignTokens(t *testing.T) {
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("blonde-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	expired, err := signer.MakeJWT(uuid.New(), -time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(expired); err == nil {
+		t.Error("expected expired token to be rejected")
+	}
+
+	// same kid, different secret
+	other, err := NewSigner(NewHMACKey("hmac", []byte("bronze-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	foreign, err := other.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(foreign); err == nil {
+		t.Error("expected token with wrong secret to be rejected")
+	}
+}
+
+func TestSignerVerifyOnlyKeys(t *testing.T) {
+	rsaKey, edKey := newTestKeys(t)
+
+	oldSigner, err := NewSigner(rsaKey)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	tokenString, err := oldSigner.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+
+	// new signer knows the old key
+	signer, err := NewSigner(edKey, rsaKey)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(tokenString); err != nil {
+		t.Errorf("expected token from verify only key to validate: %v", err)
+	}
+
+	// and one that doesn't
+	signer, err = NewSigner(edKey)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	if _, err = signer.ValidateJWT(tokenString); err == nil {
+		t.Error("expected token with unknown kid to be rejected")
+	}
+}
+
+func TestSignerRejectsAlgorithmMismatch(t *testing.T) {
+	rsaKey, _ := newTestKeys(t)
+	signer, err := NewSigner(rsaKey)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	// HS256 token claiming the RSA kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = rsaKey.ID
+	tokenString, err := token.SignedString([]byte("mechaman"))
+	if err != nil {
+		t.Fatalf("SignedString failed: %v", err)
+	}
+
+	if _, err = signer.ValidateJWT(tokenString); err == nil {
+		t.Error("expected HS256 token for RSA key to be rejected")
+	}
+}
+
+func TestSignerAccessClaims(t *testing.T) {
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("blonde-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	userID := uuid.New()
+	tokenString, err := signer.MakeAccessToken(userID, time.Hour, AccessClaims{
+		Scope:       ScopeChirpsRead,
+		IsChirpyRed: true,
+		Role:        "moderator",
+	})
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+
+	claims, err := signer.ValidateAccessToken(tokenString)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken failed: %v", err)
+	}
+	if gotID, _ := claims.UserID(); gotID != userID {
+		t.Errorf("expected user %v, got %v", userID, gotID)
+	}
+	if !claims.IsChirpyRed || claims.Role != "moderator" {
+		t.Errorf("expected custom claims to survive, got %+v", claims)
+	}
+	if !claims.HasScope(ScopeChirpsRead) || claims.HasScope(ScopeChirpsWrite) {
+		t.Errorf("expected only %s, got %q", ScopeChirpsRead, claims.Scope)
+	}
+
+	// from before scopes, no scope claim at all
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID.String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = "hmac"
+	tokenString, err = token.SignedString([]byte("blonde-blazer"))
+	if err != nil {
+		t.Fatalf("SignedString failed: %v", err)
+	}
+	claims, err = signer.ValidateAccessToken(tokenString)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken failed: %v", err)
+	}
+	if !claims.HasScope(ScopeUsersWrite) {
+		t.Errorf("expected old token to get login scopes, got %q", claims.Scope)
+	}
+}
+
+type fakeDenylist map[string]bool
+
+func (d fakeDenylist) IsRevoked(jti string, userID uuid.UUID, issuedAt time.Time) bool {
+	return d[jti]
+}
+
+func TestSignerDenylist(t *testing.T) {
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("blonde-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	denylist := fakeDenylist{}
+	signer.SetDenylist(denylist)
+
+	tokenString, err := signer.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	claims, err := signer.ParseAccessToken(tokenString)
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatal("expected token to carry a jti")
+	}
+	if _, err = signer.ValidateJWT(tokenString); err != nil {
+		t.Fatalf("ValidateJWT failed: %v", err)
+	}
+
+	denylist[claims.ID] = true
+	if _, err = signer.ValidateJWT(tokenString); err == nil {
+		t.Error("expected revoked token to be rejected")
+	}
+}
+
+func TestSignerJWKS(t *testing.T) {
+	rsaKey, edKey := newTestKeys(t)
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("mechaman")), rsaKey, edKey)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	jwks := signer.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 public keys, got %d", len(jwks.Keys))
+	}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kid == "hmac" {
+			t.Error("HMAC key must not be published")
+		}
+		if jwk.Kid == "" {
+			t.Error("expected every published key to have a kid")
+		}
+	}
+}
+
+func TestPrivateKeyPEMRoundTrip(t *testing.T) {
+	rsaKey, edKey := newTestKeys(t)
+	for _, key := range []*Key{rsaKey, edKey} {
+		data, err := key.PrivateKeyPEM()
+		if err != nil {
+			t.Fatalf("PrivateKeyPEM failed: %v", err)
+		}
+		parsed, err := ParsePrivateKeyPEM(key.ID, data)
+		if err != nil {
+			t.Fatalf("ParsePrivateKeyPEM failed: %v", err)
+		}
+		if parsed.ID != key.ID || parsed.Method != key.Method || !parsed.CanSign() {
+			t.Errorf("round trip changed the key: %+v", parsed)
+		}
+	}
+
+	if _, err := NewHMACKey("hmac", []byte("blonde-blazer")).PrivateKeyPEM(); err == nil {
+		t.Error("expected HMAC key to have no PEM")
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import "time"
+
+// ThrottlePolicy decides how long a client has to wait after failed logins.
+// the first FreeAttempts failures cost nothing, after that the wait doubles
+// with every failure up to MaxDelay, and LockoutAfter failures lock the
+// account (or ip) for LockoutDuration
+type ThrottlePolicy struct {
+	Window          time.Duration // only failures this recent count
+	FreeAttempts    int64
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int64
+	LockoutDuration time.Duration
+}
+
+var AccountThrottle = ThrottlePolicy{
+	Window:          time.Hour,
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// one ip trying many accounts gets more slack, it might be a shared NAT
+var IPThrottle = ThrottlePolicy{
+	Window:          15 * time.Minute,
+	FreeAttempts:    10,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    50,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// RetryAfter returns how much longer the client has to wait, 0 if it may try
+// now. failures is the number of failures inside Window, lastFailure the most
+// recent one
+func (p ThrottlePolicy) RetryAfter(failures int64, lastFailure, now time.Time) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	var delay time.Duration
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		delay = p.LockoutDuration
+	} else {
+		delay = p.BaseDelay
+		for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, p.MaxDelay)
+	}
+
+	wait := lastFailure.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicyRetryAfter(t *testing.T) {
+	policy := ThrottlePolicy{
+		Window:          time.Hour,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		failures    int64
+		lastFailure time.Time
+		want        time.Duration
+	}{
+		{"no failures", 0, time.Time{}, 0},
+		{"free attempts", 2, now, 0},
+		{"first delay", 3, now, time.Second},
+		{"doubles", 5, now, 4 * time.Second},
+		{"capped", 9, now, time.Minute},
+		{"locked out", 10, now, 15 * time.Minute},
+		{"delay already served", 5, now.Add(-time.Minute), 0},
+		{"lockout partly served", 12, now.Add(-5 * time.Minute), 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.RetryAfter(tt.failures, tt.lastFailure, now)
+			if got != tt.want {
+				t.Errorf("RetryAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
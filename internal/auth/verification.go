@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const emailVerificationAudience = "chirpy-email-verification"
+
+type emailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailVerificationToken signs a token for the address the user has right
+// now, so changing email makes any older verification token useless. it is
+// single use because verifying only works while the email is unverified
+func (s *Signer) MakeEmailVerificationToken(userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	claims := emailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	}
+	return s.sign(claims)
+}
+
+// ValidateEmailVerificationToken returns the user and the email the token was
+// issued for
+func (s *Signer) ValidateEmailVerificationToken(tokenString string) (uuid.UUID, string, error) {
+	claims := &emailVerificationClaims{}
+	_, err := s.parse(tokenString, claims, jwt.WithAudience(emailVerificationAudience))
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	if claims.Email == "" {
+		return uuid.UUID{}, "", errors.New("missing email claim")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	return userID, claims.Email, nil
+}
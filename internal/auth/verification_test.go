@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	signer, err := NewSigner(NewHMACKey("hmac", []byte("blonde-blazer")))
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := signer.MakeEmailVerificationToken(userID, "mechaman@chirpy.dev", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken failed: %v", err)
+	}
+
+	gotID, gotEmail, err := signer.ValidateEmailVerificationToken(token)
+	if err != nil {
+		t.Fatalf("ValidateEmailVerificationToken failed: %v", err)
+	}
+	if gotID != userID || gotEmail != "mechaman@chirpy.dev" {
+		t.Errorf("expected %v/%s, got %v/%s", userID, "mechaman@chirpy.dev", gotID, gotEmail)
+	}
+
+	// not usable as an access token
+	if _, err = signer.ValidateJWT(token); err == nil {
+		t.Error("expected verification token to be rejected as access token")
+	}
+
+	// and the other way round
+	accessToken, err := signer.MakeJWT(userID, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if _, _, err = signer.ValidateEmailVerificationToken(accessToken); err == nil {
+		t.Error("expected access token to be rejected as verification token")
+	}
+}
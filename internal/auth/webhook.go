@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader looks like "t=1700000000,v1=<hex hmac>". more than
+// one v1 is allowed so the sender can sign with an old and a new secret while
+// the secret is rotated
+const WebhookSignatureHeader = "Polka-Signature"
+
+// WebhookTolerance is how far the signed timestamp may be from our clock. a
+// captured request stops being replayable after this
+const WebhookTolerance = 5 * time.Minute
+
+// SignWebhook is the HMAC-SHA256 of "<unix timestamp>.<raw body>"
+func SignWebhook(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature header against the raw body. the body
+// has to be the exact bytes that were sent, not re-encoded json
+func VerifyWebhook(headers http.Header, secret, body []byte, now time.Time) error {
+	header := headers.Get(WebhookSignatureHeader)
+	if header == "" {
+		return errors.New("missing signature header")
+	}
+
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return errors.New("malformed signature header")
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed signature timestamp: %w", err)
+			}
+			timestamp = t
+		case "v1":
+			signatures = append(signatures, value)
+		}
+		// unknown schemes are ignored, the sender may add newer ones
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return errors.New("signature header needs t and v1")
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > WebhookTolerance || age < -WebhookTolerance {
+		return fmt.Errorf("signature timestamp is %v off, outside the tolerance", age.Round(time.Second))
+	}
+
+	expected := []byte(SignWebhook(secret, timestamp, body))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
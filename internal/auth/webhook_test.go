@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := []byte("polka-secret")
+	oldSecret := []byte("polka-secret-old")
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	now := time.Unix(1700000000, 0)
+	ts := now.Unix()
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		wantErr bool
+	}{
+		{"valid", fmt.Sprintf("t=%d,v1=%s", ts, SignWebhook(secret, ts, body)), body, false},
+		{"valid during rotation", fmt.Sprintf("t=%d,v1=%s,v1=%s", ts, SignWebhook(oldSecret, ts, body), SignWebhook(secret, ts, body)), body, false},
+		{"slightly ahead", fmt.Sprintf("t=%d,v1=%s", ts+60, SignWebhook(secret, ts+60, body)), body, false},
+		{"missing", "", body, true},
+		{"no timestamp", "v1=" + SignWebhook(secret, ts, body), body, true},
+		{"wrong secret", fmt.Sprintf("t=%d,v1=%s", ts, SignWebhook(oldSecret, ts, body)), body, true},
+		{"tampered body", fmt.Sprintf("t=%d,v1=%s", ts, SignWebhook(secret, ts, body)), []byte(`{"event":"user.upgraded"}`), true},
+		{"timestamp swapped", fmt.Sprintf("t=%d,v1=%s", ts+1, SignWebhook(secret, ts, body)), body, true},
+		{"replayed later", fmt.Sprintf("t=%d,v1=%s", ts-600, SignWebhook(secret, ts-600, body)), body, true},
+		{"from the future", fmt.Sprintf("t=%d,v1=%s", ts+600, SignWebhook(secret, ts+600, body)), body, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.header != "" {
+				headers.Set(WebhookSignatureHeader, tt.header)
+			}
+			err := VerifyWebhook(headers, secret, tt.body, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
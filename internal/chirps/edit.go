@@ -0,0 +1,10 @@
+package chirps
+
+import "time"
+
+// EditWindowOpen is whether a chirp posted at postedAt can still be edited.
+// a window of 0 means no limit, and scheduled chirps can be edited until they
+// are out, the window starts then
+func EditWindowOpen(postedAt time.Time, window time.Duration, now time.Time) bool {
+	return window <= 0 || !now.After(postedAt.Add(window))
+}
@@ -0,0 +1,31 @@
+package chirps
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEditWindowOpen(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		postedAt time.Time
+		window   time.Duration
+		want     bool
+	}{
+		{"no window", now.Add(-365 * 24 * time.Hour), 0, true},
+		{"inside", now.Add(-10 * time.Minute), 15 * time.Minute, true},
+		{"right at the end", now.Add(-15 * time.Minute), 15 * time.Minute, true},
+		{"past", now.Add(-16 * time.Minute), 15 * time.Minute, false},
+		{"scheduled", now.Add(24 * time.Hour), 15 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EditWindowOpen(tt.postedAt, tt.window, now); got != tt.want {
+				t.Errorf("EditWindowOpen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package chirps
+
+import "github.com/google/uuid"
+
+// Post is what a thread needs to know about a chirp
+type Post struct {
+	ID        uuid.UUID
+	InReplyTo uuid.NullUUID
+	Deleted   bool
+}
+
+// Node is a post in a thread with its replies in the order they were given.
+// Index is the post's position in the slice passed to BuildThread, -1 for a
+// root that wasn't in it
+type Node struct {
+	Post
+	Index   int
+	Depth   int
+	Replies []*Node
+}
+
+// ReplyCount counts direct replies that aren't deleted
+func (n *Node) ReplyCount() int {
+	count := 0
+	for _, reply := range n.Replies {
+		if !reply.Deleted {
+			count++
+		}
+	}
+	return count
+}
+
+// BuildThread arranges posts, oldest first, under the thread's root.
+// deleted posts stay as tombstones while they have replies and are dropped
+// otherwise. a post whose parent is gone hangs off the root, and a root that
+// is gone is a tombstone
+func BuildThread(root uuid.UUID, posts []Post) *Node {
+	nodes := make(map[uuid.UUID]*Node, len(posts))
+	for i, post := range posts {
+		nodes[post.ID] = &Node{Post: post, Index: i}
+	}
+	rootNode, ok := nodes[root]
+	if !ok {
+		rootNode = &Node{Post: Post{ID: root, Deleted: true}, Index: -1}
+		nodes[root] = rootNode
+	}
+
+	for _, post := range posts {
+		if post.ID == root {
+			continue
+		}
+		parent, ok := nodes[post.InReplyTo.UUID]
+		if !post.InReplyTo.Valid || !ok {
+			parent = rootNode
+		}
+		parent.Replies = append(parent.Replies, nodes[post.ID])
+	}
+
+	prune(rootNode, 0)
+	return rootNode
+}
+
+// prune drops deleted leaves, bottom up so a deleted chain with nothing live
+// under it goes entirely, and sets depths
+func prune(n *Node, depth int) {
+	n.Depth = depth
+	replies := n.Replies[:0]
+	for _, reply := range n.Replies {
+		prune(reply, depth+1)
+		if reply.Deleted && len(reply.Replies) == 0 {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+	n.Replies = replies
+}
+
+// Flatten lists the thread depth first, each post followed by its replies
+func (n *Node) Flatten() []*Node {
+	nodes := []*Node{n}
+	for _, reply := range n.Replies {
+		nodes = append(nodes, reply.Flatten()...)
+	}
+	return nodes
+}
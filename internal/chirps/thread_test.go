@@ -0,0 +1,80 @@
+package chirps
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func reply(id, parent uuid.UUID, deleted bool) Post {
+	return Post{ID: id, InReplyTo: uuid.NullUUID{UUID: parent, Valid: true}, Deleted: deleted}
+}
+
+func indexes(nodes []*Node) []int {
+	var got []int
+	for _, node := range nodes {
+		got = append(got, node.Index)
+	}
+	return got
+}
+
+func TestBuildThread(t *testing.T) {
+	root, a, b, c, d := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	posts := []Post{
+		{ID: root},
+		reply(a, root, false),
+		reply(b, a, false),
+		reply(c, root, false),
+		reply(d, a, false),
+	}
+
+	thread := BuildThread(root, posts)
+	if got := indexes(thread.Flatten()); !slices.Equal(got, []int{0, 1, 2, 4, 3}) {
+		t.Errorf("unexpected order %v", got)
+	}
+	if thread.ReplyCount() != 2 || thread.Replies[0].ReplyCount() != 2 {
+		t.Errorf("unexpected reply counts %d and %d", thread.ReplyCount(), thread.Replies[0].ReplyCount())
+	}
+	if depth := thread.Replies[0].Replies[0].Depth; depth != 2 {
+		t.Errorf("depth = %d, want 2", depth)
+	}
+}
+
+func TestBuildThreadTombstones(t *testing.T) {
+	root, a, b, c, d := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	posts := []Post{
+		{ID: root},
+		// deleted with a live reply, stays
+		reply(a, root, true),
+		reply(b, a, false),
+		// deleted chain with nothing live under it, goes
+		reply(c, root, true),
+		reply(d, c, true),
+	}
+
+	thread := BuildThread(root, posts)
+	if got := indexes(thread.Flatten()); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Errorf("unexpected posts %v", got)
+	}
+	if thread.ReplyCount() != 0 {
+		t.Errorf("tombstones should not count as replies, got %d", thread.ReplyCount())
+	}
+}
+
+func TestBuildThreadMissingRoot(t *testing.T) {
+	root, a, b := uuid.New(), uuid.New(), uuid.New()
+	posts := []Post{
+		reply(a, root, false),
+		// parent was purged
+		{ID: b},
+	}
+
+	thread := BuildThread(root, posts)
+	if thread.ID != root || !thread.Deleted || thread.Index != -1 {
+		t.Errorf("expected a tombstone root, got %+v", thread.Post)
+	}
+	if got := indexes(thread.Flatten()); !slices.Equal(got, []int{-1, 0, 1}) {
+		t.Errorf("unexpected posts %v", got)
+	}
+}
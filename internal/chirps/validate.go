@@ -0,0 +1,115 @@
+package chirps
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Violation is one failed rule, Rule is stable for clients to match on
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "chirp rejected: " + strings.Join(rules, ", ")
+}
+
+// Rule checks a body and may rewrite it (normalizing, masking). it returns
+// the body for the next rule and a violation if the chirp can't be posted
+type Rule func(body string) (string, *Violation)
+
+// Pipeline runs its rules in order. every rule runs even after a violation,
+// so the client learns about all of them at once
+type Pipeline []Rule
+
+// New is the pipeline create, edit and validate share. profanity runs last,
+// on the normalized body, and may be nil
+func New(maxLength int, profanity Rule) Pipeline {
+	pipeline := Pipeline{Normalize, NotEmpty, MaxLength(maxLength)}
+	if profanity != nil {
+		pipeline = append(pipeline, profanity)
+	}
+	return pipeline
+}
+
+// Validate returns the body as it should be stored, or a *ValidationError
+func (p Pipeline) Validate(body string) (string, error) {
+	var violations []Violation
+	for _, rule := range p {
+		var violation *Violation
+		body, violation = rule(body)
+		if violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+	if len(violations) > 0 {
+		return "", &ValidationError{Violations: violations}
+	}
+	return body, nil
+}
+
+// Normalize puts the body in NFC, so "é" counts and compares the same however
+// it was typed, drops control characters other than newlines and tabs and the
+// invisible characters in isInvisible, and trims surrounding whitespace
+func Normalize(body string) (string, *Violation) {
+	body = strings.ToValidUTF8(body, string(utf8.RuneError))
+	body = norm.NFC.String(body)
+	body = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r), isInvisible(r):
+			return -1
+		}
+		return r
+	}, body)
+	return strings.TrimSpace(body), nil
+}
+
+// zero width spaces, the BOM and bidi overrides/isolates. not all of Cf, the
+// zero width joiner and non-joiner (U+200D, U+200C) hold emoji sequences and
+// Persian and Indic words together
+func isInvisible(r rune) bool {
+	switch {
+	case r == '\u200b', r == '\u2060', r == '\ufeff':
+		return true
+	case r >= '\u202a' && r <= '\u202e':
+		return true
+	case r >= '\u2066' && r <= '\u2069':
+		return true
+	}
+	return false
+}
+
+func NotEmpty(body string) (string, *Violation) {
+	if body == "" {
+		return body, &Violation{Rule: "empty", Message: "chirp can't be empty"}
+	}
+	return body, nil
+}
+
+// MaxLength counts characters, not bytes
+func MaxLength(max int) Rule {
+	return func(body string) (string, *Violation) {
+		if length := utf8.RuneCountInString(body); length > max {
+			return body, &Violation{
+				Rule:    "max_length",
+				Message: fmt.Sprintf("chirp is %d characters, the limit is %d", length, max),
+			}
+		}
+		return body, nil
+	}
+}
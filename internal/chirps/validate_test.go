@@ -0,0 +1,76 @@
+package chirps
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	mask := func(body string) (string, *Violation) {
+		return strings.ReplaceAll(body, "fornax", "****"), nil
+	}
+	pipeline := New(10, mask)
+
+	tests := []struct {
+		name      string
+		body      string
+		want      string
+		wantRules []string
+	}{
+		{"plain", "hello", "hello", nil},
+		{"trimmed", "  hello \n", "hello", nil},
+		{"empty", "", "", []string{"empty"}},
+		{"only whitespace", " \t\n ", "", []string{"empty"}},
+		{"only invisible", "\u200b\u2060\ufeff\u202e\u2066", "", []string{"empty"}},
+		// joiners are part of the text, not padding
+		{"emoji zwj sequence", "\U0001F468\u200d\U0001F469\u200d\U0001F467", "\U0001F468\u200d\U0001F469\u200d\U0001F467", nil},
+		{"zwnj word", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645", nil},
+		{"too long", "hello world!", "", []string{"max_length"}},
+		// "é" as e + combining acute is two runes until normalized
+		{"combining characters count once", strings.Repeat("e\u0301", 10), strings.Repeat("\u00e9", 10), nil},
+		{"zero width padding", "he\u200bllo", "hello", nil},
+		{"controls dropped", "a\x00b\x1bc", "abc", nil},
+		{"profanity runs after normalizing", "fornax\u200b", "****", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pipeline.Validate(tt.body)
+			var validationErr *ValidationError
+			if tt.wantRules == nil {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Validate() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a *ValidationError", err)
+			}
+			var rules []string
+			for _, v := range validationErr.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if !slices.Equal(rules, tt.wantRules) {
+				t.Errorf("Validate() violated %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestPipelineReportsEveryViolation(t *testing.T) {
+	alwaysFails := func(body string) (string, *Violation) {
+		return body, &Violation{Rule: "always", Message: "always fails"}
+	}
+	pipeline := Pipeline{Normalize, MaxLength(3), alwaysFails}
+
+	_, err := pipeline.Validate("chirpy")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 {
+		t.Fatalf("expected two violations, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: chirprevisions.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createChirpRevision = `-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, revision, body, written_at, replaced_at)
+SELECT
+  gen_random_uuid(),
+  chirps.id,
+  (SELECT COALESCE(MAX(revision), 0) + 1 FROM chirp_revisions WHERE chirp_id = chirps.id),
+  chirps.body,
+  chirps.updated_at,
+  NOW()
+FROM chirps
+WHERE chirps.id = $1
+`
+
+func (q *Queries) CreateChirpRevision(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, createChirpRevision, id)
+	return err
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, chirp_id, revision, body, written_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY revision ASC
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Revision,
+			&i.Body,
+			&i.WrittenAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
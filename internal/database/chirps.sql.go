@@ -7,29 +7,64 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countScheduledChirps = `-- name: CountScheduledChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at > NOW()
+`
+
+func (q *Queries) CountScheduledChirps(ctx context.Context, userID uuid.NullUUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countScheduledChirps, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+WITH new_chirp AS (
+  SELECT gen_random_uuid() AS id
+)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, in_reply_to, thread_id)
 VALUES (
-  gen_random_uuid(),
+  (SELECT id FROM new_chirp),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3,
+  CASE WHEN cardinality($4::text[]) > 0 THEN NOW() END,
+  $4::text[],
+  $5,
+  -- a new conversation unless it is a reply
+  COALESCE($6::uuid, (SELECT id FROM new_chirp))
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.NullUUID
+	Body         string
+	UserID       uuid.NullUUID
+	PublishAt    sql.NullTime
+	FlaggedWords []string
+	InReplyTo    uuid.NullUUID
+	ThreadID     uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.PublishAt,
+		pq.Array(arg.FlaggedWords),
+		arg.InReplyTo,
+		arg.ThreadID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,27 +72,49 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
+	)
+	return i, err
 }
 
-const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+const getChirpForAuthor = `-- name: GetChirpForAuthor :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+func (q *Queries) GetChirpForAuthor(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForAuthor, id)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -65,12 +122,32 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
 	)
 	return i, err
 }
 
+const getChirpThreadID = `-- name: GetChirpThreadID :one
+SELECT thread_id FROM chirps
+WHERE id = $1 AND (publish_at IS NULL OR publish_at <= NOW())
+`
+
+func (q *Queries) GetChirpThreadID(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getChirpThreadID, id)
+	var thread_id uuid.UUID
+	err := row.Scan(&thread_id)
+	return thread_id, err
+}
+
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
 ORDER BY created_at ASC
 `
 
@@ -89,6 +166,79 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentChirpCount = `-- name: GetRecentChirpCount :one
+SELECT COUNT(*) AS chirps, COALESCE(MIN(created_at), NOW())::timestamp AS oldest
+FROM chirps
+WHERE user_id = $1 AND created_at > $2
+`
+
+type GetRecentChirpCountParams struct {
+	UserID uuid.NullUUID
+	Since  time.Time
+}
+
+type GetRecentChirpCountRow struct {
+	Chirps int64
+	Oldest time.Time
+}
+
+func (q *Queries) GetRecentChirpCount(ctx context.Context, arg GetRecentChirpCountParams) (GetRecentChirpCountRow, error) {
+	row := q.db.QueryRowContext(ctx, getRecentChirpCount, arg.UserID, arg.Since)
+	var i GetRecentChirpCountRow
+	err := row.Scan(&i.Chirps, &i.Oldest)
+	return i, err
+}
+
+const getThread = `-- name: GetThread :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE thread_id = $1 AND (publish_at IS NULL OR publish_at <= NOW())
+ORDER BY created_at ASC
+`
+
+// deleted chirps included, they are shown as tombstones
+func (q *Queries) GetThread(ctx context.Context, threadID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getThread, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
 		); err != nil {
 			return nil, err
 		}
@@ -104,8 +254,8 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getUserChirps = `-- name: GetUserChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
 ORDER BY created_at ASC
 `
 
@@ -124,6 +274,60 @@ func (q *Queries) GetUserChirps(ctx context.Context, userID uuid.NullUUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeletedChirps = `-- name: ListDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE user_id = $1 AND deleted_by = $1 AND deleted_at > $2::timestamp
+ORDER BY deleted_at DESC
+`
+
+type ListDeletedChirpsParams struct {
+	UserID       uuid.NullUUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) ListDeletedChirps(ctx context.Context, arg ListDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedChirps, arg.UserID, arg.DeletedAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +341,200 @@ func (q *Queries) GetUserChirps(ctx context.Context, userID uuid.NullUUID) ([]Ch
 	}
 	return items, nil
 }
+
+const listScheduledChirps = `-- name: ListScheduledChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at > NOW()
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) ListScheduledChirps(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockChirp = `-- name: LockChirp :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, lockChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
+	)
+	return i, err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1::timestamp
+  AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.in_reply_to = chirps.id)
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL
+WHERE id = $1
+  AND user_id = $2
+  AND deleted_by = $2
+  AND deleted_at > $3::timestamp
+RETURNING id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id
+`
+
+type RestoreChirpParams struct {
+	ID           uuid.UUID
+	UserID       uuid.NullUUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.UserID, arg.DeletedAfter)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
+	)
+	return i, err
+}
+
+const scrubDeletedChirps = `-- name: ScrubDeletedChirps :execrows
+WITH scrubbed_revisions AS (
+  DELETE FROM chirp_revisions
+  WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE deleted_at < $1::timestamp
+  )
+)
+UPDATE chirps
+SET body = '', flagged_at = NULL, flagged_words = NULL
+WHERE deleted_at < $1::timestamp
+  AND body <> ''
+`
+
+// chirps with replies stay as tombstones so their threads hold together,
+// only what they said goes
+func (q *Queries) ScrubDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, scrubDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), deleted_by = $2
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SoftDeleteChirpParams struct {
+	ID        uuid.UUID
+	DeletedBy uuid.NullUUID
+}
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, arg SoftDeleteChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, arg.ID, arg.DeletedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1,
+    updated_at = NOW(),
+    flagged_at = CASE WHEN cardinality($2::text[]) > 0 THEN NOW() END,
+    flagged_words = $2::text[]
+WHERE id = $3
+RETURNING id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id
+`
+
+type UpdateChirpBodyParams struct {
+	Body         string
+	FlaggedWords []string
+	ID           uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, pq.Array(arg.FlaggedWords), arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.FlaggedAt,
+		pq.Array(&i.FlaggedWords),
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.InReplyTo,
+		&i.ThreadID,
+	)
+	return i, err
+}
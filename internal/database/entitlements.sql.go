@@ -0,0 +1,103 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: entitlements.sql
+
+package database
+
+import (
+	"context"
+)
+
+const getEntitlements = `-- name: GetEntitlements :one
+SELECT tier, updated_at, max_chirp_length, chirps_per_hour, max_scheduled_chirps, can_edit FROM entitlements
+WHERE tier = $1
+`
+
+func (q *Queries) GetEntitlements(ctx context.Context, tier string) (Entitlement, error) {
+	row := q.db.QueryRowContext(ctx, getEntitlements, tier)
+	var i Entitlement
+	err := row.Scan(
+		&i.Tier,
+		&i.UpdatedAt,
+		&i.MaxChirpLength,
+		&i.ChirpsPerHour,
+		&i.MaxScheduledChirps,
+		&i.CanEdit,
+	)
+	return i, err
+}
+
+const listEntitlements = `-- name: ListEntitlements :many
+SELECT tier, updated_at, max_chirp_length, chirps_per_hour, max_scheduled_chirps, can_edit FROM entitlements
+ORDER BY max_chirp_length
+`
+
+func (q *Queries) ListEntitlements(ctx context.Context) ([]Entitlement, error) {
+	rows, err := q.db.QueryContext(ctx, listEntitlements)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Entitlement
+	for rows.Next() {
+		var i Entitlement
+		if err := rows.Scan(
+			&i.Tier,
+			&i.UpdatedAt,
+			&i.MaxChirpLength,
+			&i.ChirpsPerHour,
+			&i.MaxScheduledChirps,
+			&i.CanEdit,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateEntitlements = `-- name: UpdateEntitlements :one
+UPDATE entitlements
+SET updated_at = NOW(),
+    max_chirp_length = $2,
+    chirps_per_hour = $3,
+    max_scheduled_chirps = $4,
+    can_edit = $5
+WHERE tier = $1
+RETURNING tier, updated_at, max_chirp_length, chirps_per_hour, max_scheduled_chirps, can_edit
+`
+
+type UpdateEntitlementsParams struct {
+	Tier               string
+	MaxChirpLength     int32
+	ChirpsPerHour      int32
+	MaxScheduledChirps int32
+	CanEdit            bool
+}
+
+func (q *Queries) UpdateEntitlements(ctx context.Context, arg UpdateEntitlementsParams) (Entitlement, error) {
+	row := q.db.QueryRowContext(ctx, updateEntitlements,
+		arg.Tier,
+		arg.MaxChirpLength,
+		arg.ChirpsPerHour,
+		arg.MaxScheduledChirps,
+		arg.CanEdit,
+	)
+	var i Entitlement
+	err := row.Scan(
+		&i.Tier,
+		&i.UpdatedAt,
+		&i.MaxChirpLength,
+		&i.ChirpsPerHour,
+		&i.MaxScheduledChirps,
+		&i.CanEdit,
+	)
+	return i, err
+}
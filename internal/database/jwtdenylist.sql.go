@@ -0,0 +1,140 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: jwtdenylist.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteExpiredJWTRevocationCutoffs = `-- name: DeleteExpiredJWTRevocationCutoffs :exec
+DELETE FROM jwt_revocation_cutoffs
+WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredJWTRevocationCutoffs(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredJWTRevocationCutoffs)
+	return err
+}
+
+const deleteExpiredRevokedJWTs = `-- name: DeleteExpiredRevokedJWTs :exec
+DELETE FROM revoked_jwts
+WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredRevokedJWTs(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredRevokedJWTs)
+	return err
+}
+
+const listJWTRevocationCutoffs = `-- name: ListJWTRevocationCutoffs :many
+SELECT user_id, updated_at, revoked_before, expires_at FROM jwt_revocation_cutoffs
+WHERE expires_at > NOW()
+`
+
+func (q *Queries) ListJWTRevocationCutoffs(ctx context.Context) ([]JwtRevocationCutoff, error) {
+	rows, err := q.db.QueryContext(ctx, listJWTRevocationCutoffs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JwtRevocationCutoff
+	for rows.Next() {
+		var i JwtRevocationCutoff
+		if err := rows.Scan(
+			&i.UserID,
+			&i.UpdatedAt,
+			&i.RevokedBefore,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRevokedJWTs = `-- name: ListRevokedJWTs :many
+SELECT jti, created_at, expires_at FROM revoked_jwts
+WHERE expires_at > NOW()
+`
+
+func (q *Queries) ListRevokedJWTs(ctx context.Context) ([]RevokedJwt, error) {
+	rows, err := q.db.QueryContext(ctx, listRevokedJWTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RevokedJwt
+	for rows.Next() {
+		var i RevokedJwt
+		if err := rows.Scan(&i.Jti, &i.CreatedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeJWT = `-- name: RevokeJWT :exec
+INSERT INTO revoked_jwts (jti, created_at, expires_at)
+VALUES (
+  $1,
+  NOW(),
+  $2
+)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeJWTParams struct {
+	Jti       string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) RevokeJWT(ctx context.Context, arg RevokeJWTParams) error {
+	_, err := q.db.ExecContext(ctx, revokeJWT, arg.Jti, arg.ExpiresAt)
+	return err
+}
+
+const setJWTRevocationCutoff = `-- name: SetJWTRevocationCutoff :exec
+INSERT INTO jwt_revocation_cutoffs (user_id, updated_at, revoked_before, expires_at)
+VALUES (
+  $1,
+  NOW(),
+  $2,
+  $3
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+  revoked_before = GREATEST(jwt_revocation_cutoffs.revoked_before, EXCLUDED.revoked_before),
+  expires_at = GREATEST(jwt_revocation_cutoffs.expires_at, EXCLUDED.expires_at)
+`
+
+type SetJWTRevocationCutoffParams struct {
+	UserID        uuid.UUID
+	RevokedBefore time.Time
+	ExpiresAt     time.Time
+}
+
+// a cutoff only ever moves forward
+func (q *Queries) SetJWTRevocationCutoff(ctx context.Context, arg SetJWTRevocationCutoffParams) error {
+	_, err := q.db.ExecContext(ctx, setJWTRevocationCutoff, arg.UserID, arg.RevokedBefore, arg.ExpiresAt)
+	return err
+}
@@ -0,0 +1,152 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: loginattempts.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createLoginAttempt = `-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (id, created_at, email, user_id, ip, success)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4
+)
+`
+
+type CreateLoginAttemptParams struct {
+	Email   string
+	UserID  uuid.NullUUID
+	Ip      string
+	Success bool
+}
+
+func (q *Queries) CreateLoginAttempt(ctx context.Context, arg CreateLoginAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, createLoginAttempt,
+		arg.Email,
+		arg.UserID,
+		arg.Ip,
+		arg.Success,
+	)
+	return err
+}
+
+const deleteLoginAttemptsBefore = `-- name: DeleteLoginAttemptsBefore :exec
+DELETE FROM login_attempts
+WHERE created_at < $1
+`
+
+func (q *Queries) DeleteLoginAttemptsBefore(ctx context.Context, createdAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteLoginAttemptsBefore, createdAt)
+	return err
+}
+
+const getAccountLoginFailures = `-- name: GetAccountLoginFailures :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(f.created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts f
+WHERE f.email = $1
+  AND f.success = false
+  AND f.created_at > $2
+  AND f.created_at > COALESCE(
+    (SELECT MAX(s.created_at) FROM login_attempts s WHERE s.email = $1 AND s.success = true),
+    'epoch'
+  )
+`
+
+type GetAccountLoginFailuresParams struct {
+	Email string
+	Since time.Time
+}
+
+type GetAccountLoginFailuresRow struct {
+	Failures    int64
+	LastFailure time.Time
+}
+
+// failures since the last successful login, inside the window
+func (q *Queries) GetAccountLoginFailures(ctx context.Context, arg GetAccountLoginFailuresParams) (GetAccountLoginFailuresRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccountLoginFailures, arg.Email, arg.Since)
+	var i GetAccountLoginFailuresRow
+	err := row.Scan(&i.Failures, &i.LastFailure)
+	return i, err
+}
+
+const getIPLoginFailures = `-- name: GetIPLoginFailures :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts
+WHERE ip = $1
+  AND success = false
+  AND created_at > $2
+`
+
+type GetIPLoginFailuresParams struct {
+	Ip    string
+	Since time.Time
+}
+
+type GetIPLoginFailuresRow struct {
+	Failures    int64
+	LastFailure time.Time
+}
+
+func (q *Queries) GetIPLoginFailures(ctx context.Context, arg GetIPLoginFailuresParams) (GetIPLoginFailuresRow, error) {
+	row := q.db.QueryRowContext(ctx, getIPLoginFailures, arg.Ip, arg.Since)
+	var i GetIPLoginFailuresRow
+	err := row.Scan(&i.Failures, &i.LastFailure)
+	return i, err
+}
+
+const listLoginAttempts = `-- name: ListLoginAttempts :many
+SELECT id, created_at, email, user_id, ip, success FROM login_attempts
+WHERE ($1::text IS NULL OR email = $1)
+  AND ($2::text IS NULL OR ip = $2)
+ORDER BY created_at DESC
+LIMIT $3
+`
+
+type ListLoginAttemptsParams struct {
+	Email sql.NullString
+	Ip    sql.NullString
+	Lim   int32
+}
+
+func (q *Queries) ListLoginAttempts(ctx context.Context, arg ListLoginAttemptsParams) ([]LoginAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, listLoginAttempts, arg.Email, arg.Ip, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoginAttempt
+	for rows.Next() {
+		var i LoginAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Email,
+			&i.UserID,
+			&i.Ip,
+			&i.Success,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
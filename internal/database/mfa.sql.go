@@ -0,0 +1,172 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: mfa.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const confirmTOTPSecret = `-- name: ConfirmTOTPSecret :exec
+UPDATE totp_secrets
+SET confirmed_at = NOW(), updated_at = NOW(), last_used_step = $2
+WHERE user_id = $1
+`
+
+type ConfirmTOTPSecretParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) ConfirmTOTPSecret(ctx context.Context, arg ConfirmTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, confirmTOTPSecret, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, user_id, used_at)
+VALUES (
+  $1,
+  NOW(),
+  $2,
+  NULL
+)
+`
+
+type CreateRecoveryCodeParams struct {
+	CodeHash string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.CodeHash, arg.UserID)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteTOTPSecret = `-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTOTPSecret, userID)
+	return err
+}
+
+const getTOTPSecret = `-- name: GetTOTPSecret :one
+SELECT user_id, created_at, updated_at, secret, confirmed_at, last_used_step FROM totp_secrets
+WHERE user_id = $1
+`
+
+func (q *Queries) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, getTOTPSecret, userID)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+	)
+	return i, err
+}
+
+const upsertTOTPSecret = `-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret, confirmed_at, last_used_step)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  NULL,
+  0
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = NOW(), last_used_step = 0
+WHERE totp_secrets.confirmed_at IS NULL
+RETURNING user_id, created_at, updated_at, secret, confirmed_at, last_used_step
+`
+
+type UpsertTOTPSecretParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+func (q *Queries) UpsertTOTPSecret(ctx context.Context, arg UpsertTOTPSecretParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, upsertTOTPSecret, arg.UserID, arg.Secret)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :one
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL
+RETURNING code_hash, created_at, user_id, used_at
+`
+
+type UseRecoveryCodeParams struct {
+	CodeHash string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error) {
+	row := q.db.QueryRowContext(ctx, useRecoveryCode, arg.CodeHash, arg.UserID)
+	var i RecoveryCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :one
+UPDATE totp_secrets
+SET last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2
+RETURNING user_id, created_at, updated_at, secret, confirmed_at, last_used_step
+`
+
+type UseTOTPStepParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, useTOTPStep, arg.UserID, arg.LastUsedStep)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+	)
+	return i, err
+}
@@ -11,28 +11,234 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type BillingReconciliation struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	RunID          uuid.UUID
+	Source         string
+	UserID         uuid.UUID
+	Kind           string
+	Action         string
+	PolkaStatus    sql.NullString
+	PolkaPeriodEnd sql.NullTime
+	LocalStatus    sql.NullString
+	LocalPeriodEnd sql.NullTime
+}
+
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.NullUUID
+	PublishAt    sql.NullTime
+	FlaggedAt    sql.NullTime
+	FlaggedWords []string
+	DeletedAt    sql.NullTime
+	DeletedBy    uuid.NullUUID
+	InReplyTo    uuid.NullUUID
+	ThreadID     uuid.UUID
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Revision   int32
+	Body       string
+	WrittenAt  time.Time
+	ReplacedAt time.Time
+}
+
+type Entitlement struct {
+	Tier               string
+	UpdatedAt          time.Time
+	MaxChirpLength     int32
+	ChirpsPerHour      int32
+	MaxScheduledChirps int32
+	CanEdit            bool
+}
+
+type JwtRevocationCutoff struct {
+	UserID        uuid.UUID
+	UpdatedAt     time.Time
+	RevokedBefore time.Time
+	ExpiresAt     time.Time
+}
+
+type LoginAttempt struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+	Email     string
 	UserID    uuid.NullUUID
+	Ip        string
+	Success   bool
 }
 
-type RefreshToken struct {
-	Token     string
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+	RevokedAt    sql.NullTime
+}
+
+type OauthConsent struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	UserID    uuid.NullUUID
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	CreatedAt    time.Time
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   uuid.NullUUID
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PolkaEvent struct {
+	ID          string
+	Event       string
+	UserID      uuid.NullUUID
+	ProcessedAt time.Time
+}
+
+type ProfanityWord struct {
+	Locale    string
+	Word      string
+	Listed    bool
+	UpdatedAt time.Time
+	UpdatedBy uuid.NullUUID
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.NullUUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type RevokedJwt struct {
+	Jti       string
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+}
+
+type Role struct {
+	Name        string
+	Description string
+}
+
+type SigningKey struct {
+	Kid           string
+	PrivateKeyPem string
+	CreatedAt     time.Time
+	ActivatesAt   time.Time
+}
+
+type Subscription struct {
+	UserID             uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Status             string
+	Source             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   sql.NullTime
+	CancelledAt        sql.NullTime
+}
+
+type TotpSecret struct {
+	UserID       uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	EmailVerifiedAt sql.NullTime
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserMembership struct {
+	UserID      uuid.UUID
+	IsChirpyRed bool
+}
+
+type UserRole struct {
+	UserID    uuid.UUID
+	Role      string
+	CreatedAt time.Time
+	GrantedBy uuid.NullUUID
 }
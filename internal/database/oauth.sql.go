@@ -0,0 +1,295 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: oauth.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createAuthorizationCode = `-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at, used_at)
+VALUES (
+  $1,
+  NOW(),
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  NULL
+)
+`
+
+type CreateAuthorizationCodeParams struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	ExpiresAt     time.Time
+}
+
+func (q *Queries) CreateAuthorizationCode(ctx context.Context, arg CreateAuthorizationCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.FamilyID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, owner_id, name, secret_hash, redirect_uris, scopes, revoked_at)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  NULL
+)
+RETURNING id, created_at, owner_id, name, secret_hash, redirect_uris, scopes, revoked_at
+`
+
+type CreateOAuthClientParams struct {
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.OwnerID,
+		arg.Name,
+		arg.SecretHash,
+		pq.Array(arg.RedirectUris),
+		pq.Array(arg.Scopes),
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.OwnerID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredAuthorizationCodes = `-- name: DeleteExpiredAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredAuthorizationCodes(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredAuthorizationCodes, expiresAt)
+	return err
+}
+
+const getAuthorizationCode = `-- name: GetAuthorizationCode :one
+SELECT code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at, used_at FROM oauth_authorization_codes
+WHERE code_hash = $1
+`
+
+func (q *Queries) GetAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, getAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.FamilyID,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, created_at, owner_id, name, secret_hash, redirect_uris, scopes, revoked_at FROM oauth_clients
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id uuid.UUID) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.OwnerID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getOAuthConsent = `-- name: GetOAuthConsent :one
+SELECT user_id, client_id, scopes, created_at, updated_at FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2
+`
+
+type GetOAuthConsentParams struct {
+	UserID   uuid.UUID
+	ClientID uuid.UUID
+}
+
+func (q *Queries) GetOAuthConsent(ctx context.Context, arg GetOAuthConsentParams) (OauthConsent, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthConsent, arg.UserID, arg.ClientID)
+	var i OauthConsent
+	err := row.Scan(
+		&i.UserID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listUserOAuthClients = `-- name: ListUserOAuthClients :many
+SELECT id, created_at, owner_id, name, secret_hash, redirect_uris, scopes, revoked_at FROM oauth_clients
+WHERE owner_id = $1 AND revoked_at IS NULL
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.QueryContext(ctx, listUserOAuthClients, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.OwnerID,
+			&i.Name,
+			&i.SecretHash,
+			pq.Array(&i.RedirectUris),
+			pq.Array(&i.Scopes),
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeOAuthClientRefreshTokens = `-- name: RevokeOAuthClientRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE client_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeOAuthClientRefreshTokens(ctx context.Context, clientID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, revokeOAuthClientRefreshTokens, clientID)
+	return err
+}
+
+const revokeUserOAuthClient = `-- name: RevokeUserOAuthClient :execrows
+UPDATE oauth_clients
+SET revoked_at = NOW()
+WHERE id = $1 AND owner_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserOAuthClientParams struct {
+	ID      uuid.UUID
+	OwnerID uuid.UUID
+}
+
+func (q *Queries) RevokeUserOAuthClient(ctx context.Context, arg RevokeUserOAuthClientParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserOAuthClient, arg.ID, arg.OwnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const saveOAuthConsent = `-- name: SaveOAuthConsent :exec
+INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+VALUES (
+  $1,
+  $2,
+  $3,
+  NOW(),
+  NOW()
+)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scopes = EXCLUDED.scopes, updated_at = NOW()
+`
+
+type SaveOAuthConsentParams struct {
+	UserID   uuid.UUID
+	ClientID uuid.UUID
+	Scopes   []string
+}
+
+func (q *Queries) SaveOAuthConsent(ctx context.Context, arg SaveOAuthConsentParams) error {
+	_, err := q.db.ExecContext(ctx, saveOAuthConsent, arg.UserID, arg.ClientID, pq.Array(arg.Scopes))
+	return err
+}
+
+const useAuthorizationCode = `-- name: UseAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at, used_at
+`
+
+func (q *Queries) UseAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, useAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.CreatedAt,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.FamilyID,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,48 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: polkaevents.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deletePolkaEventsBefore = `-- name: DeletePolkaEventsBefore :exec
+DELETE FROM polka_events
+WHERE processed_at < $1
+`
+
+func (q *Queries) DeletePolkaEventsBefore(ctx context.Context, processedAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deletePolkaEventsBefore, processedAt)
+	return err
+}
+
+const recordPolkaEvent = `-- name: RecordPolkaEvent :execrows
+INSERT INTO polka_events (id, event, user_id, processed_at)
+VALUES (
+  $1,
+  $2,
+  $3,
+  NOW()
+)
+ON CONFLICT (id) DO NOTHING
+`
+
+type RecordPolkaEventParams struct {
+	ID     string
+	Event  string
+	UserID uuid.NullUUID
+}
+
+func (q *Queries) RecordPolkaEvent(ctx context.Context, arg RecordPolkaEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recordPolkaEvent, arg.ID, arg.Event, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
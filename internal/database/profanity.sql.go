@@ -0,0 +1,134 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: profanity.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const clearChirpFlag = `-- name: ClearChirpFlag :execrows
+UPDATE chirps
+SET flagged_at = NULL, flagged_words = NULL
+WHERE id = $1 AND flagged_at IS NOT NULL AND deleted_at IS NULL
+`
+
+func (q *Queries) ClearChirpFlag(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, clearChirpFlag, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listFlaggedChirps = `-- name: ListFlaggedChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, deleted_at, deleted_by, in_reply_to, thread_id FROM chirps
+WHERE flagged_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY flagged_at ASC
+LIMIT $1
+`
+
+func (q *Queries) ListFlaggedChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listFlaggedChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.FlaggedAt,
+			pq.Array(&i.FlaggedWords),
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.InReplyTo,
+			&i.ThreadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProfanityWords = `-- name: ListProfanityWords :many
+SELECT locale, word, listed, updated_at, updated_by FROM profanity_words
+ORDER BY locale, word
+`
+
+func (q *Queries) ListProfanityWords(ctx context.Context) ([]ProfanityWord, error) {
+	rows, err := q.db.QueryContext(ctx, listProfanityWords)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ProfanityWord
+	for rows.Next() {
+		var i ProfanityWord
+		if err := rows.Scan(
+			&i.Locale,
+			&i.Word,
+			&i.Listed,
+			&i.UpdatedAt,
+			&i.UpdatedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setProfanityWord = `-- name: SetProfanityWord :exec
+INSERT INTO profanity_words (locale, word, listed, updated_at, updated_by)
+VALUES (
+  $1,
+  $2,
+  $3,
+  NOW(),
+  $4
+)
+ON CONFLICT (locale, word) DO UPDATE
+SET listed = EXCLUDED.listed, updated_at = NOW(), updated_by = EXCLUDED.updated_by
+`
+
+type SetProfanityWordParams struct {
+	Locale    string
+	Word      string
+	Listed    bool
+	UpdatedBy uuid.NullUUID
+}
+
+func (q *Queries) SetProfanityWord(ctx context.Context, arg SetProfanityWordParams) error {
+	_, err := q.db.ExecContext(ctx, setProfanityWord,
+		arg.Locale,
+		arg.Word,
+		arg.Listed,
+		arg.UpdatedBy,
+	)
+	return err
+}
@@ -0,0 +1,98 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: reconciliations.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createBillingReconciliation = `-- name: CreateBillingReconciliation :exec
+INSERT INTO billing_reconciliations (id, created_at, run_id, source, user_id, kind, action, polka_status, polka_period_end, local_status, local_period_end)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9
+)
+`
+
+type CreateBillingReconciliationParams struct {
+	RunID          uuid.UUID
+	Source         string
+	UserID         uuid.UUID
+	Kind           string
+	Action         string
+	PolkaStatus    sql.NullString
+	PolkaPeriodEnd sql.NullTime
+	LocalStatus    sql.NullString
+	LocalPeriodEnd sql.NullTime
+}
+
+func (q *Queries) CreateBillingReconciliation(ctx context.Context, arg CreateBillingReconciliationParams) error {
+	_, err := q.db.ExecContext(ctx, createBillingReconciliation,
+		arg.RunID,
+		arg.Source,
+		arg.UserID,
+		arg.Kind,
+		arg.Action,
+		arg.PolkaStatus,
+		arg.PolkaPeriodEnd,
+		arg.LocalStatus,
+		arg.LocalPeriodEnd,
+	)
+	return err
+}
+
+const listBillingReconciliations = `-- name: ListBillingReconciliations :many
+SELECT id, created_at, run_id, source, user_id, kind, action, polka_status, polka_period_end, local_status, local_period_end FROM billing_reconciliations
+ORDER BY created_at DESC
+LIMIT $1
+`
+
+func (q *Queries) ListBillingReconciliations(ctx context.Context, limit int32) ([]BillingReconciliation, error) {
+	rows, err := q.db.QueryContext(ctx, listBillingReconciliations, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BillingReconciliation
+	for rows.Next() {
+		var i BillingReconciliation
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.RunID,
+			&i.Source,
+			&i.UserID,
+			&i.Kind,
+			&i.Action,
+			&i.PolkaStatus,
+			&i.PolkaPeriodEnd,
+			&i.LocalStatus,
+			&i.LocalPeriodEnd,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: signingkeys.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const createSigningKey = `-- name: CreateSigningKey :execrows
+INSERT INTO signing_keys (kid, private_key_pem, created_at, activates_at)
+VALUES (
+  $1,
+  $2,
+  NOW(),
+  $3
+)
+ON CONFLICT (kid) DO NOTHING
+`
+
+type CreateSigningKeyParams struct {
+	Kid           string
+	PrivateKeyPem string
+	ActivatesAt   time.Time
+}
+
+func (q *Queries) CreateSigningKey(ctx context.Context, arg CreateSigningKeyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createSigningKey, arg.Kid, arg.PrivateKeyPem, arg.ActivatesAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteReplacedSigningKeys = `-- name: DeleteReplacedSigningKeys :exec
+DELETE FROM signing_keys
+WHERE EXISTS (
+  SELECT 1 FROM signing_keys newer
+  WHERE newer.activates_at > signing_keys.activates_at AND newer.activates_at < $1
+)
+`
+
+func (q *Queries) DeleteReplacedSigningKeys(ctx context.Context, before time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteReplacedSigningKeys, before)
+	return err
+}
+
+const listSigningKeys = `-- name: ListSigningKeys :many
+SELECT kid, private_key_pem, created_at, activates_at FROM signing_keys
+ORDER BY activates_at
+`
+
+func (q *Queries) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := q.db.QueryContext(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SigningKey
+	for rows.Next() {
+		var i SigningKey
+		if err := rows.Scan(
+			&i.Kid,
+			&i.PrivateKeyPem,
+			&i.CreatedAt,
+			&i.ActivatesAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,237 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const endSubscription = `-- name: EndSubscription :execrows
+UPDATE subscriptions
+SET updated_at = NOW(), status = $2, current_period_end = LEAST(current_period_end, NOW())
+WHERE user_id = $1 AND status IN ('active', 'cancelled')
+`
+
+type EndSubscriptionParams struct {
+	UserID uuid.UUID
+	Status string
+}
+
+func (q *Queries) EndSubscription(ctx context.Context, arg EndSubscriptionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, endSubscription, arg.UserID, arg.Status)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const expireSubscriptions = `-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'expired'
+WHERE status IN ('active', 'cancelled') AND current_period_end <= NOW()
+RETURNING user_id
+`
+
+// bookkeeping only, users stop being red when the period ends either way
+func (q *Queries) ExpireSubscriptions(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, expireSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const filterExistingUserIDs = `-- name: FilterExistingUserIDs :many
+SELECT id FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) FilterExistingUserIDs(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, filterExistingUserIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubscriptionForUpdate = `-- name: GetSubscriptionForUpdate :one
+SELECT user_id, created_at, updated_at, status, source, current_period_start, current_period_end, cancelled_at FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetSubscriptionForUpdate(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscriptionForUpdate, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.Source,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const isChirpyRed = `-- name: IsChirpyRed :one
+SELECT is_chirpy_red FROM user_memberships
+WHERE user_id = $1
+`
+
+func (q *Queries) IsChirpyRed(ctx context.Context, userID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isChirpyRed, userID)
+	var is_chirpy_red bool
+	err := row.Scan(&is_chirpy_red)
+	return is_chirpy_red, err
+}
+
+const listMembershipStates = `-- name: ListMembershipStates :many
+SELECT user_id, status, current_period_end FROM subscriptions
+`
+
+type ListMembershipStatesRow struct {
+	UserID           uuid.UUID
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+}
+
+func (q *Queries) ListMembershipStates(ctx context.Context) ([]ListMembershipStatesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listMembershipStates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMembershipStatesRow
+	for rows.Next() {
+		var i ListMembershipStatesRow
+		if err := rows.Scan(&i.UserID, &i.Status, &i.CurrentPeriodEnd); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const saveSubscription = `-- name: SaveSubscription :exec
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, source, current_period_start, current_period_end, cancelled_at)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  $3,
+  $4,
+  $5,
+  $6
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+    status = EXCLUDED.status,
+    source = EXCLUDED.source,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    cancelled_at = EXCLUDED.cancelled_at
+`
+
+type SaveSubscriptionParams struct {
+	UserID             uuid.UUID
+	Status             string
+	Source             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   sql.NullTime
+	CancelledAt        sql.NullTime
+}
+
+func (q *Queries) SaveSubscription(ctx context.Context, arg SaveSubscriptionParams) error {
+	_, err := q.db.ExecContext(ctx, saveSubscription,
+		arg.UserID,
+		arg.Status,
+		arg.Source,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+		arg.CancelledAt,
+	)
+	return err
+}
+
+const setSubscription = `-- name: SetSubscription :exec
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, source, current_period_start, current_period_end)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  $3,
+  NOW(),
+  $4
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+    status = EXCLUDED.status,
+    source = EXCLUDED.source,
+    current_period_end = EXCLUDED.current_period_end
+`
+
+type SetSubscriptionParams struct {
+	UserID           uuid.UUID
+	Status           string
+	Source           string
+	CurrentPeriodEnd sql.NullTime
+}
+
+func (q *Queries) SetSubscription(ctx context.Context, arg SetSubscriptionParams) error {
+	_, err := q.db.ExecContext(ctx, setSubscription,
+		arg.UserID,
+		arg.Status,
+		arg.Source,
+		arg.CurrentPeriodEnd,
+	)
+	return err
+}
@@ -0,0 +1,144 @@
+package denylist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Queries is the part of database.Queries the store needs
+type Queries interface {
+	RevokeJWT(ctx context.Context, arg database.RevokeJWTParams) error
+	SetJWTRevocationCutoff(ctx context.Context, arg database.SetJWTRevocationCutoffParams) error
+	ListRevokedJWTs(ctx context.Context) ([]database.RevokedJwt, error)
+	ListJWTRevocationCutoffs(ctx context.Context) ([]database.JwtRevocationCutoff, error)
+	DeleteExpiredRevokedJWTs(ctx context.Context) error
+	DeleteExpiredJWTRevocationCutoffs(ctx context.Context) error
+}
+
+// Store is the access token denylist. postgres is the source of truth, every
+// instance keeps the whole (small, everything in it expires with the tokens)
+// list in memory so checking a token never hits the database. revocations
+// made here apply right away, ones made by other instances show up on the
+// next Sync
+type Store struct {
+	q           Queries
+	maxTokenAge time.Duration
+
+	mu      sync.RWMutex
+	jtis    map[string]time.Time    // jti -> token expiry
+	cutoffs map[uuid.UUID]time.Time // user -> tokens issued before this are dead
+}
+
+// maxTokenAge is the longest an access token lives, a user cutoff is kept
+// that long and then forgotten since every token it covered has expired
+func New(q Queries, maxTokenAge time.Duration) *Store {
+	return &Store{
+		q:           q,
+		maxTokenAge: maxTokenAge,
+		jtis:        map[string]time.Time{},
+		cutoffs:     map[uuid.UUID]time.Time{},
+	}
+}
+
+// RevokeToken denies a single token until it would have expired anyway
+func (s *Store) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	err := s.q.RevokeJWT(ctx, database.RevokeJWTParams{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.jtis[jti] = expiresAt
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUserTokensBefore denies every token the user was issued before the
+// given time
+func (s *Store) RevokeUserTokensBefore(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	err := s.q.SetJWTRevocationCutoff(ctx, database.SetJWTRevocationCutoffParams{
+		UserID:        userID,
+		RevokedBefore: before,
+		ExpiresAt:     before.Add(s.maxTokenAge),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if before.After(s.cutoffs[userID]) {
+		s.cutoffs[userID] = before
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked implements auth.Denylist. iat only has second precision, so a
+// token from the same second as the cutoff counts as issued before it. that
+// also catches one minted right after the cutoff, which is the safe side
+func (s *Store) IsRevoked(jti string, userID uuid.UUID, issuedAt time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if jti != "" {
+		if _, ok := s.jtis[jti]; ok {
+			return true
+		}
+	}
+	if cutoff, ok := s.cutoffs[userID]; ok && !issuedAt.After(cutoff) {
+		return true
+	}
+	return false
+}
+
+// Sync replaces the in-memory copy with what's in postgres
+func (s *Store) Sync(ctx context.Context) error {
+	revokedJWTs, err := s.q.ListRevokedJWTs(ctx)
+	if err != nil {
+		return err
+	}
+	cutoffs, err := s.q.ListJWTRevocationCutoffs(ctx)
+	if err != nil {
+		return err
+	}
+
+	jtis := make(map[string]time.Time, len(revokedJWTs))
+	for _, revoked := range revokedJWTs {
+		jtis[revoked.Jti] = revoked.ExpiresAt
+	}
+	cutoffsByUser := make(map[uuid.UUID]time.Time, len(cutoffs))
+	for _, cutoff := range cutoffs {
+		cutoffsByUser[cutoff.UserID] = cutoff.RevokedBefore
+	}
+
+	s.mu.Lock()
+	s.jtis = jtis
+	s.cutoffs = cutoffsByUser
+	s.mu.Unlock()
+	return nil
+}
+
+// Refresh deletes expired entries and then syncs, main runs it periodically.
+// a failed cleanup doesn't stop the sync
+func (s *Store) Refresh(ctx context.Context) error {
+	var errs []error
+	if err := s.q.DeleteExpiredRevokedJWTs(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("delete expired revoked jwts: %w", err))
+	}
+	if err := s.q.DeleteExpiredJWTRevocationCutoffs(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("delete expired revocation cutoffs: %w", err))
+	}
+	if err := s.Sync(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("sync: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+package denylist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeQueries stands in for postgres, shared between stores like the real
+// table is between instances
+type fakeQueries struct {
+	jwts    []database.RevokedJwt
+	cutoffs map[uuid.UUID]database.JwtRevocationCutoff
+}
+
+func (q *fakeQueries) RevokeJWT(ctx context.Context, arg database.RevokeJWTParams) error {
+	q.jwts = append(q.jwts, database.RevokedJwt{Jti: arg.Jti, CreatedAt: time.Now(), ExpiresAt: arg.ExpiresAt})
+	return nil
+}
+
+func (q *fakeQueries) SetJWTRevocationCutoff(ctx context.Context, arg database.SetJWTRevocationCutoffParams) error {
+	if existing, ok := q.cutoffs[arg.UserID]; ok && existing.RevokedBefore.After(arg.RevokedBefore) {
+		return nil
+	}
+	q.cutoffs[arg.UserID] = database.JwtRevocationCutoff{
+		UserID:        arg.UserID,
+		UpdatedAt:     time.Now(),
+		RevokedBefore: arg.RevokedBefore,
+		ExpiresAt:     arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (q *fakeQueries) ListRevokedJWTs(ctx context.Context) ([]database.RevokedJwt, error) {
+	return q.jwts, nil
+}
+
+func (q *fakeQueries) ListJWTRevocationCutoffs(ctx context.Context) ([]database.JwtRevocationCutoff, error) {
+	cutoffs := make([]database.JwtRevocationCutoff, 0, len(q.cutoffs))
+	for _, cutoff := range q.cutoffs {
+		cutoffs = append(cutoffs, cutoff)
+	}
+	return cutoffs, nil
+}
+
+func (q *fakeQueries) DeleteExpiredRevokedJWTs(ctx context.Context) error {
+	return nil
+}
+
+func (q *fakeQueries) DeleteExpiredJWTRevocationCutoffs(ctx context.Context) error {
+	return nil
+}
+
+func TestRevokeToken(t *testing.T) {
+	q := &fakeQueries{cutoffs: map[uuid.UUID]database.JwtRevocationCutoff{}}
+	store := New(q, time.Hour)
+	userID := uuid.New()
+
+	if err := store.RevokeToken(context.Background(), "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if !store.IsRevoked("jti-1", userID, time.Now()) {
+		t.Error("expected revoked jti to be revoked")
+	}
+	if store.IsRevoked("jti-2", userID, time.Now()) {
+		t.Error("expected other jti to not be revoked")
+	}
+}
+
+func TestRevokeUserTokensBefore(t *testing.T) {
+	q := &fakeQueries{cutoffs: map[uuid.UUID]database.JwtRevocationCutoff{}}
+	store := New(q, time.Hour)
+	userID := uuid.New()
+	cutoff := time.Now()
+
+	if err := store.RevokeUserTokensBefore(context.Background(), userID, cutoff); err != nil {
+		t.Fatalf("RevokeUserTokensBefore failed: %v", err)
+	}
+	if !store.IsRevoked("", userID, cutoff.Add(-time.Minute)) {
+		t.Error("expected older token to be revoked")
+	}
+	if store.IsRevoked("", userID, cutoff.Add(time.Second)) {
+		t.Error("expected newer token to not be revoked")
+	}
+	if store.IsRevoked("", uuid.New(), cutoff.Add(-time.Minute)) {
+		t.Error("expected other user's token to not be revoked")
+	}
+	// iat is truncated to the second, the token used for the request that set
+	// the cutoff has the cutoff's second
+	if !store.IsRevoked("", userID, cutoff.Truncate(time.Second)) {
+		t.Error("expected token from the same second as the cutoff to be revoked")
+	}
+
+	// an earlier cutoff doesn't undo a later one
+	if err := store.RevokeUserTokensBefore(context.Background(), userID, cutoff.Add(-time.Hour)); err != nil {
+		t.Fatalf("RevokeUserTokensBefore failed: %v", err)
+	}
+	if !store.IsRevoked("", userID, cutoff.Add(-time.Minute)) {
+		t.Error("expected older token to stay revoked")
+	}
+}
+
+func TestSync(t *testing.T) {
+	q := &fakeQueries{cutoffs: map[uuid.UUID]database.JwtRevocationCutoff{}}
+	store := New(q, time.Hour)
+	other := New(q, time.Hour)
+	userID := uuid.New()
+
+	if err := other.RevokeToken(context.Background(), "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if err := other.RevokeUserTokensBefore(context.Background(), userID, time.Now()); err != nil {
+		t.Fatalf("RevokeUserTokensBefore failed: %v", err)
+	}
+	if store.IsRevoked("jti-1", uuid.New(), time.Now()) {
+		t.Error("expected revocation from another instance to be unknown before sync")
+	}
+
+	if err := store.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !store.IsRevoked("jti-1", uuid.New(), time.Now()) {
+		t.Error("expected synced jti to be revoked")
+	}
+	if !store.IsRevoked("", userID, time.Now().Add(-time.Minute)) {
+		t.Error("expected synced cutoff to apply")
+	}
+}
+
+func TestRefreshSyncs(t *testing.T) {
+	q := &fakeQueries{cutoffs: map[uuid.UUID]database.JwtRevocationCutoff{}}
+	store := New(q, time.Hour)
+	other := New(q, time.Hour)
+
+	if err := other.RevokeToken(context.Background(), "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if err := store.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if !store.IsRevoked("jti-1", uuid.New(), time.Now()) {
+		t.Error("expected refresh to pick up the other instance's revocation")
+	}
+}
@@ -0,0 +1,342 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Mode is what happens to a chirp with a listed word in it
+type Mode string
+
+const (
+	// ModeMask replaces the word with ****, the chirp goes out
+	ModeMask Mode = "mask"
+	// ModeReject refuses the chirp
+	ModeReject Mode = "reject"
+	// ModeFlag lets the chirp out unchanged and queues it for a moderator
+	ModeFlag Mode = "flag"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(s)); mode {
+	case ModeMask, ModeReject, ModeFlag:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("filter mode %q, modes are mask, reject and flag", s)
+	}
+}
+
+// Filter holds word lists per locale (a language tag like "en" or "de"). the
+// lists from files are the base, admins add and remove words on top of them
+// at runtime with SetOverrides. safe for concurrent use
+type Filter struct {
+	mode Mode
+
+	mu      sync.RWMutex
+	base    map[string][]string
+	added   map[string][]string
+	removed map[string][]string
+	// normalized word -> listed, per locale, rebuilt on every change
+	words map[string]map[string]bool
+	// the same words with repeated letters collapsed, for elongated input
+	collapsed map[string]map[string]bool
+}
+
+func New(mode Mode) *Filter {
+	return &Filter{
+		mode:      mode,
+		base:      map[string][]string{},
+		added:     map[string][]string{},
+		removed:   map[string][]string{},
+		words:     map[string]map[string]bool{},
+		collapsed: map[string]map[string]bool{},
+	}
+}
+
+func (f *Filter) Mode() Mode {
+	return f.mode
+}
+
+// LoadDir reads <locale>.txt files, one word per line, blank lines and lines
+// starting with # are skipped
+func (f *Filter) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var words []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			words = append(words, line)
+		}
+		file.Close()
+		if err = scanner.Err(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		f.SetWords(strings.TrimSuffix(filepath.Base(path), ".txt"), words)
+	}
+	return nil
+}
+
+// SetWords replaces the base list of a locale
+func (f *Filter) SetWords(locale string, words []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.base[strings.ToLower(locale)] = words
+	f.rebuild()
+}
+
+// SetOverrides replaces every runtime change at once, removed wins over added
+func (f *Filter) SetOverrides(added, removed map[string][]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added, f.removed = lowerKeys(added), lowerKeys(removed)
+	f.rebuild()
+}
+
+func lowerKeys(m map[string][]string) map[string][]string {
+	lowered := make(map[string][]string, len(m))
+	for locale, words := range m {
+		lowered[strings.ToLower(locale)] = append(lowered[strings.ToLower(locale)], words...)
+	}
+	return lowered
+}
+
+func (f *Filter) rebuild() {
+	words := map[string]map[string]bool{}
+	for _, lists := range []map[string][]string{f.base, f.added} {
+		for locale, list := range lists {
+			if words[locale] == nil {
+				words[locale] = map[string]bool{}
+			}
+			for _, word := range list {
+				if normalized := Normalize(word); normalized != "" {
+					words[locale][normalized] = true
+				}
+			}
+		}
+	}
+	for locale, list := range f.removed {
+		for _, word := range list {
+			delete(words[locale], Normalize(word))
+		}
+	}
+	collapsed := map[string]map[string]bool{}
+	for locale, list := range words {
+		collapsed[locale] = map[string]bool{}
+		for word := range list {
+			collapsed[locale][collapseRepeats(word)] = true
+		}
+	}
+	f.words, f.collapsed = words, collapsed
+}
+
+// Locales lists every locale that has words
+func (f *Filter) Locales() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var locales []string
+	for locale, words := range f.words {
+		if len(words) > 0 {
+			locales = append(locales, locale)
+		}
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Words is the effective list of a locale, normalized
+func (f *Filter) Words(locale string) []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	words := make([]string, 0, len(f.words[strings.ToLower(locale)]))
+	for word := range f.words[strings.ToLower(locale)] {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+	return words
+}
+
+// Check looks for listed words from any of locales. it returns the body with
+// every match masked and the matched words as they were written
+func (f *Filter) Check(body string, locales ...string) (string, []string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// exact matches only, unless the word is stretched out ("fooorrnax"). then
+	// repeats are collapsed on both sides, which would otherwise merge words
+	// like "as" and "ass"
+	listed := func(word string) bool {
+		elongated := hasRun(word, 3)
+		for _, locale := range locales {
+			locale = strings.ToLower(locale)
+			if f.words[locale][word] || elongated && f.collapsed[locale][collapseRepeats(word)] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var masked strings.Builder
+	var matches []string
+	last := 0
+	for _, token := range tokenize(body) {
+		start, end, ok := token.match(body, listed)
+		if !ok {
+			continue
+		}
+		matches = append(matches, body[start:end])
+		masked.WriteString(body[last:start])
+		masked.WriteString("****")
+		last = end
+	}
+	if matches == nil {
+		return body, nil
+	}
+	masked.WriteString(body[last:])
+	return masked.String(), matches
+}
+
+// a token is a run of letters, digits and the symbols people use as letters,
+// as byte offsets into the body
+type token struct {
+	start, end int
+}
+
+// symbols that stand in for letters, see leet. anywhere else they are
+// punctuation, so "kerfuffle!" is still kerfuffle
+const leetSymbols = "@$!|+"
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || strings.ContainsRune(leetSymbols, r)
+}
+
+func tokenize(body string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range body {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			tokens = append(tokens, token{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start, len(body)})
+	}
+	return tokens
+}
+
+// match tries the whole token ("sh@rbert") and then without symbols at the
+// ends ("@fornax", "fornax!!")
+func (t token) match(body string, listed func(string) bool) (int, int, bool) {
+	// numbers aren't words, "455" is not leetspeak for anything
+	if !strings.ContainsFunc(body[t.start:t.end], unicode.IsLetter) {
+		return 0, 0, false
+	}
+	if listed(Normalize(body[t.start:t.end])) {
+		return t.start, t.end, true
+	}
+	trimmed := strings.Trim(body[t.start:t.end], leetSymbols)
+	if trimmed == "" || trimmed == body[t.start:t.end] {
+		return 0, 0, false
+	}
+	if listed(Normalize(trimmed)) {
+		start := t.start + strings.Index(body[t.start:t.end], trimmed)
+		return start, start + len(trimmed), true
+	}
+	return 0, 0, false
+}
+
+// leetspeak digits and symbols, read as the letter they usually stand for
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// letters from other scripts that look like latin ones, lowercase
+var homoglyphs = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+	// latin lookalikes
+	'ı': 'i', 'ɡ': 'g', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ß': 's',
+}
+
+// Normalize folds a word to the form lists are matched in: compatibility
+// decomposed (fullwidth and styled letters become plain ones), accents
+// dropped, lowercase, and homoglyphs and leetspeak read as latin letters
+func Normalize(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if mapped, ok := homoglyphs[r]; ok {
+			r = mapped
+		} else if mapped, ok := leet[r]; ok {
+			r = mapped
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// collapseRepeats turns every run of the same letter into one, "fooorrnax"
+// is "fornax"
+func collapseRepeats(word string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range word {
+		if r != prev {
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// hasRun reports whether some letter repeats n or more times in a row
+func hasRun(word string, n int) bool {
+	var prev rune
+	run := 0
+	for _, r := range word {
+		if r == prev {
+			run++
+		} else {
+			run = 1
+		}
+		if run >= n {
+			return true
+		}
+		prev = r
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Kerfuffle": "kerfuffle",
+		"KERFUFFLE": "kerfuffle",
+		"k3rfuffl3": "kerfuffle",
+		"sh@rb3rt":  "sharbert",
+		"f0rn@x":    "fornax",
+		"fоrnах":    "fornax", // cyrillic о, а and х
+		"ｆｏｒｎａｘ":    "fornax", // fullwidth
+		"fórnäx":    "fornax",
+		"f.o.r":     "for",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f := New(ModeMask)
+	f.SetWords("en", []string{"kerfuffle", "sharbert", "fornax"})
+	f.SetWords("sv", []string{"kerfuffle", "blixt"})
+
+	tests := []struct {
+		name        string
+		body        string
+		locales     []string
+		wantMasked  string
+		wantMatches []string
+	}{
+		{"clean", "what a lovely day", []string{"en"}, "what a lovely day", nil},
+		{"punctuation", "Kerfuffle! what a kerfuffle, really", []string{"en"}, "****! what a ****, really", []string{"Kerfuffle", "kerfuffle"}},
+		{"leetspeak", "total sh@rb3rt", []string{"en"}, "total ****", []string{"sh@rb3rt"}},
+		{"symbol at the end", "fornax!!", []string{"en"}, "****!!", []string{"fornax"}},
+		{"mention", "@fornax hi", []string{"en"}, "@**** hi", []string{"fornax"}},
+		{"homoglyph", "fоrnах", []string{"en"}, "****", []string{"fоrnах"}},
+		{"no substring matches", "fornaxes are not a thing", []string{"en"}, "fornaxes are not a thing", nil},
+		{"other locale", "blixt", []string{"en"}, "blixt", nil},
+		{"locale list", "blixt", []string{"en", "sv"}, "****", []string{"blixt"}},
+		{"newlines", "line\nfornax\n", []string{"en"}, "line\n****\n", []string{"fornax"}},
+		{"elongated", "fooorrrnaxx", []string{"en"}, "****", []string{"fooorrrnaxx"}},
+		{"elongated double letter", "kerfuuuufle", []string{"en"}, "****", []string{"kerfuuuufle"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masked, matches := f.Check(tt.body, tt.locales...)
+			if masked != tt.wantMasked {
+				t.Errorf("masked = %q, want %q", masked, tt.wantMasked)
+			}
+			if !slices.Equal(matches, tt.wantMatches) {
+				t.Errorf("matches = %q, want %q", matches, tt.wantMatches)
+			}
+		})
+	}
+}
+
+// repeats only collapse when the input is stretched out, otherwise different
+// words would share a form
+func TestCheckFalsePositives(t *testing.T) {
+	f := New(ModeReject)
+	f.SetWords("en", []string{"ass", "boob"})
+
+	for _, body := range []string{"as you were", "Bob says hi", "AS IF", "it cost 455 dollars"} {
+		if _, matches := f.Check(body, "en"); matches != nil {
+			t.Errorf("Check(%q) matched %q", body, matches)
+		}
+	}
+	for _, body := range []string{"ass", "a55", "asssss", "b00b", "booooob"} {
+		if _, matches := f.Check(body, "en"); matches == nil {
+			t.Errorf("Check(%q) should match", body)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	f := New(ModeMask)
+	f.SetWords("en", []string{"kerfuffle", "fornax"})
+
+	f.SetOverrides(map[string][]string{"EN": {"Blixt"}}, map[string][]string{"en": {"f0rnax"}})
+	if got := f.Words("en"); !slices.Equal(got, []string{"blixt", "kerfuffle"}) {
+		t.Errorf("unexpected words %v", got)
+	}
+	if _, matches := f.Check("fornax blixt", "en"); !slices.Equal(matches, []string{"blixt"}) {
+		t.Errorf("unexpected matches %v", matches)
+	}
+
+	// overrides are replaced, not merged
+	f.SetOverrides(nil, nil)
+	if got := f.Words("en"); !slices.Equal(got, []string{"fornax", "kerfuffle"}) {
+		t.Errorf("unexpected words after clearing overrides %v", got)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "en.txt"), []byte("# comment\nkerfuffle\n\n  fornax  \n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "de.txt"), []byte("quatsch\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a list\n"), 0o644)
+
+	f := New(ModeReject)
+	if err := f.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	if got := f.Locales(); !slices.Equal(got, []string{"de", "en"}) {
+		t.Errorf("unexpected locales %v", got)
+	}
+	if got := f.Words("en"); !slices.Equal(got, []string{"fornax", "kerfuffle"}) {
+		t.Errorf("unexpected words %v", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"mask", "Reject", "FLAG"} {
+		if _, err := ParseMode(s); err != nil {
+			t.Errorf("ParseMode(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseMode("shadowban"); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+	msg := Message{To: "mechaman@chirpy.dev", Subject: "hi", Body: "hello"}
+
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0] != msg {
+		t.Errorf("expected %v to be recorded, got %v", msg, messages)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := FileMailer{Dir: dir, From: "chirpy@localhost"}
+
+	// newline in the address must not turn into an extra header
+	msg := Message{To: "mechaman@chirpy.dev\r\nBcc: everyone@chirpy.dev", Subject: "hi", Body: "line one\nline two"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	content := string(data)
+	if strings.Contains(content, "\r\nBcc:") {
+		t.Error("expected header injection to be stripped")
+	}
+	if !strings.Contains(content, "line one\r\nline two") {
+		t.Errorf("expected body in file, got %q", content)
+	}
+}
+
+func TestLogMailerRedactsBody(t *testing.T) {
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	msg := Message{To: "mechaman@chirpy.dev", Subject: "Reset your Chirpy password", Body: "token s3cret"}
+	if err := (LogMailer{}).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Errorf("body was logged: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := (LogMailer{ShowBody: true}).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "s3cret") {
+		t.Errorf("body missing with ShowBody: %q", buf.String())
+	}
+}
@@ -0,0 +1,246 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a local OIDC provider: discovery, jwks and a token endpoint
+// that answers any code with the ID token in idToken
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	kid    string
+	key    *rsa.PrivateKey
+	// what the token endpoint got last
+	tokenForm url.Values
+	idToken   string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	f := &fakeProvider{t: t}
+	f.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                f.server.URL,
+			AuthorizationEndpoint: f.server.URL + "/authorize",
+			TokenEndpoint:         f.server.URL + "/token",
+			JWKSURI:               f.server.URL + "/jwks",
+			IDTokenSigningAlgs:    []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": f.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if clientID, secret, ok := r.BasicAuth(); !ok || clientID != "chirpy" || secret != "hunter2" {
+			w.WriteHeader(401)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		r.ParseForm()
+		f.tokenForm = r.PostForm
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken, "token_type": "Bearer"})
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeProvider) rotate(kid string) {
+	f.t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		f.t.Fatalf("rsa.GenerateKey failed: %v", err)
+	}
+	f.kid, f.key = kid, key
+}
+
+func (f *fakeProvider) sign(claims jwt.Claims) string {
+	f.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.kid
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		f.t.Fatalf("SignedString failed: %v", err)
+	}
+	return signed
+}
+
+func (f *fakeProvider) claims(nonce string) *IDToken {
+	return &IDToken{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    f.server.URL,
+			Subject:   "blonde-blazer-1",
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Nonce:         nonce,
+		Email:         "blonde.blazer@chirpy.dev",
+		EmailVerified: true,
+	}
+}
+
+func (f *fakeProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "fake",
+		Issuer:       f.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "hunter2",
+		RedirectURL:  "http://localhost:8080/api/auth/fake/callback",
+		Scopes:       []string{"email"},
+	}, f.server.Client())
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if !strings.HasPrefix(authURL, fake.server.URL+"/authorize?") ||
+		query.Get("state") != "the-state" || query.Get("nonce") != "the-nonce" ||
+		query.Get("code_challenge") != "the-challenge" || query.Get("scope") != "openid email" {
+		t.Errorf("unexpected authorization url %s", authURL)
+	}
+
+	fake.idToken = fake.sign(fake.claims("the-nonce"))
+	idToken, err := provider.Exchange(ctx, "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if idToken.Subject != "blonde-blazer-1" || idToken.Email != "blonde.blazer@chirpy.dev" || !idToken.EmailVerified {
+		t.Errorf("unexpected claims %+v", idToken)
+	}
+	if fake.tokenForm.Get("code") != "the-code" || fake.tokenForm.Get("code_verifier") != "the-verifier" {
+		t.Errorf("unexpected token request %v", fake.tokenForm)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"wrong nonce", func() string {
+			return fake.sign(fake.claims("other-nonce"))
+		}},
+		{"wrong audience", func() string {
+			claims := fake.claims("the-nonce")
+			claims.Audience = jwt.ClaimStrings{"someone-else"}
+			return fake.sign(claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := fake.claims("the-nonce")
+			claims.Issuer = "https://evil.example"
+			return fake.sign(claims)
+		}},
+		{"expired", func() string {
+			claims := fake.claims("the-nonce")
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return fake.sign(claims)
+		}},
+		{"signed with client secret", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, fake.claims("the-nonce"))
+			signed, _ := token.SignedString([]byte("hunter2"))
+			return signed
+		}},
+		{"unknown key", func() string {
+			other, _ := rsa.GenerateKey(rand.Reader, 2048)
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, fake.claims("the-nonce"))
+			token.Header["kid"] = fake.kid
+			signed, _ := token.SignedString(other)
+			return signed
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.VerifyIDToken(ctx, tt.token(), "the-nonce"); err == nil {
+				t.Error("expected id token to be rejected")
+			}
+		})
+	}
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, fake.sign(fake.claims("n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+
+	fake.rotate("key-2")
+	// refetching is rate limited, pretend the last fetch was a while ago
+	provider.keysFetchedAt = time.Now().Add(-2 * minJWKSRefresh)
+	if _, err := provider.VerifyIDToken(ctx, fake.sign(fake.claims("n")), "n"); err != nil {
+		t.Errorf("expected token from rotated key to validate: %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	fake := newFakeProvider(t)
+	provider := fake.provider()
+	provider.Issuer = fake.server.URL + "/"
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Error("expected discovery for another issuer to be rejected")
+	}
+}
+
+func TestParseJWKEC(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey failed: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]string{
+		"kty": "EC",
+		"kid": "ec-1",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	})
+
+	kid, parsed, err := parseJWK(raw)
+	if err != nil {
+		t.Fatalf("parseJWK failed: %v", err)
+	}
+	if pub, ok := parsed.(*ecdsa.PublicKey); kid != "ec-1" || !ok || !pub.Equal(&key.PublicKey) {
+		t.Errorf("unexpected key %v %T", kid, parsed)
+	}
+}
@@ -0,0 +1,275 @@
+package polka
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Membership is one user's Chirpy Red state, as Polka or as we see it.
+// Status uses the same words as our subscriptions table. a zero PeriodEnd is
+// a member from before subscriptions whose period we never learned, only
+// ever on our side, Polka always says
+type Membership struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Status    string    `json:"status"`
+	PeriodEnd time.Time `json:"current_period_end"`
+}
+
+// Current is whether the membership makes someone red right now. cancelled
+// ones run until the end of the period
+func (m Membership) Current(now time.Time) bool {
+	return (m.Status == StatusActive || m.Status == StatusCancelled) && (m.PeriodEnd.IsZero() || m.PeriodEnd.After(now))
+}
+
+func (m *Membership) checkPeriod() error {
+	if m.PeriodEnd.IsZero() {
+		return errors.New("missing current_period_end")
+	}
+	return nil
+}
+
+// statuses are checked on the way in, -apply would only trip over them on
+// the subscriptions table's constraint, one user at a time
+func (m *Membership) normalizeStatus() error {
+	m.Status = strings.ToLower(strings.TrimSpace(m.Status))
+	switch m.Status {
+	case StatusActive, StatusCancelled, StatusExpired, StatusRefunded:
+		return nil
+	default:
+		return fmt.Errorf("status %q, statuses are active, cancelled, expired and refunded", m.Status)
+	}
+}
+
+// ReadExport reads a Polka export, the format is picked by the extension of
+// name: .json is an array of memberships, .csv has a header row with
+// user_id, status and current_period_end (RFC 3339) in any order
+func ReadExport(r io.Reader, name string) ([]Membership, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		var memberships []Membership
+		if err := json.NewDecoder(r).Decode(&memberships); err != nil {
+			return nil, fmt.Errorf("json export: %w", err)
+		}
+		for i := range memberships {
+			if err := memberships[i].normalizeStatus(); err != nil {
+				return nil, fmt.Errorf("json export entry %d: %w", i+1, err)
+			}
+			if err := memberships[i].checkPeriod(); err != nil {
+				return nil, fmt.Errorf("json export entry %d: %w", i+1, err)
+			}
+		}
+		return memberships, nil
+	case ".csv":
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("export %s has to be .csv or .json", name)
+	}
+}
+
+func readCSV(r io.Reader) ([]Membership, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv export: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"user_id", "status", "current_period_end"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv export: missing column %s", name)
+		}
+	}
+
+	var memberships []Membership
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return memberships, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv export: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		userID, err := uuid.Parse(record[columns["user_id"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv export line %d: user_id: %w", line, err)
+		}
+		periodEnd, err := time.Parse(time.RFC3339, record[columns["current_period_end"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv export line %d: current_period_end: %w", line, err)
+		}
+		membership := Membership{
+			UserID:    userID,
+			Status:    record[columns["status"]],
+			PeriodEnd: periodEnd,
+		}
+		if err = membership.normalizeStatus(); err != nil {
+			return nil, fmt.Errorf("csv export line %d: %w", line, err)
+		}
+		memberships = append(memberships, membership)
+	}
+}
+
+// Client reads memberships from the Polka API, or anything that answers
+// GET <BaseURL>/v1/memberships the same way
+type Client struct {
+	BaseURL string
+	APIKey  string
+	HTTP    *http.Client
+}
+
+// Memberships follows next_cursor until Polka has no more pages
+func (c *Client) Memberships(ctx context.Context) ([]Membership, error) {
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var memberships []Membership
+	cursor := ""
+	for {
+		u, err := url.Parse(strings.TrimSuffix(c.BaseURL, "/") + "/v1/memberships")
+		if err != nil {
+			return nil, err
+		}
+		if cursor != "" {
+			u.RawQuery = url.Values{"cursor": {cursor}}.Encode()
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "ApiKey "+c.APIKey)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Data       []Membership `json:"data"`
+			NextCursor string       `json:"next_cursor"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", u.Path, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", u.Path, err)
+		}
+
+		for i := range page.Data {
+			if err = page.Data[i].normalizeStatus(); err != nil {
+				return nil, fmt.Errorf("GET %s: user %v: %w", u.Path, page.Data[i].UserID, err)
+			}
+			if err = page.Data[i].checkPeriod(); err != nil {
+				return nil, fmt.Errorf("GET %s: user %v: %w", u.Path, page.Data[i].UserID, err)
+			}
+		}
+		memberships = append(memberships, page.Data...)
+		if page.NextCursor == "" {
+			return memberships, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// what a Discrepancy is about
+const (
+	// Polka has a current membership, we don't
+	KindMissing = "missing"
+	// we have a current membership, Polka doesn't
+	KindUnpaid = "unpaid"
+	// both current, but one is cancelled and the other isn't
+	KindStatus = "status"
+	// both current, the periods end at different times
+	KindPeriod = "period"
+	// Polka has a current membership for a user we don't have
+	KindUnknownUser = "unknown_user"
+)
+
+type Discrepancy struct {
+	UserID uuid.UUID
+	Kind   string
+	// nil when that side has no record of the user
+	Polka *Membership
+	Local *Membership
+}
+
+// periods are compared with some slack, the export may be rounded
+const periodTolerance = time.Minute
+
+// Diff compares Polka's memberships with ours, Polka being right about who
+// paid. users missing from known are reported as KindUnknownUser
+func Diff(polka []Membership, local []Membership, known map[uuid.UUID]bool, now time.Time) []Discrepancy {
+	polkaByUser := map[uuid.UUID]*Membership{}
+	for i := range polka {
+		// a user can show up more than once in an export, the latest period wins
+		if existing, ok := polkaByUser[polka[i].UserID]; !ok || polka[i].PeriodEnd.After(existing.PeriodEnd) {
+			polkaByUser[polka[i].UserID] = &polka[i]
+		}
+	}
+	localByUser := map[uuid.UUID]*Membership{}
+	for i := range local {
+		localByUser[local[i].UserID] = &local[i]
+	}
+
+	var discrepancies []Discrepancy
+	for userID, p := range polkaByUser {
+		l := localByUser[userID]
+		d := Discrepancy{UserID: userID, Polka: p, Local: l}
+
+		polkaCurrent := p.Current(now)
+		localCurrent := l != nil && l.Current(now)
+		switch {
+		case polkaCurrent && l == nil && !known[userID]:
+			d.Kind = KindUnknownUser
+		case polkaCurrent && !localCurrent:
+			d.Kind = KindMissing
+		case !polkaCurrent && localCurrent:
+			d.Kind = KindUnpaid
+		case polkaCurrent && p.Status != l.Status:
+			d.Kind = KindStatus
+		case polkaCurrent && (p.PeriodEnd.Sub(l.PeriodEnd) > periodTolerance || l.PeriodEnd.Sub(p.PeriodEnd) > periodTolerance):
+			d.Kind = KindPeriod
+		default:
+			continue
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	for userID, l := range localByUser {
+		if _, ok := polkaByUser[userID]; ok || !l.Current(now) {
+			continue
+		}
+		discrepancies = append(discrepancies, Discrepancy{UserID: userID, Kind: KindUnpaid, Local: l})
+	}
+
+	// stable reports, maps have no order
+	slices.SortFunc(discrepancies, func(a, b Discrepancy) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UserID.String(), b.UserID.String())
+	})
+	return discrepancies
+}
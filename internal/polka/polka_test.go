@@ -0,0 +1,152 @@
+package polka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReadExport(t *testing.T) {
+	userID := uuid.MustParse("3311741c-680c-4546-99f3-fc9efac2036c")
+	periodEnd := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{"csv", "export.csv", "user_id,status,current_period_end\n3311741c-680c-4546-99f3-fc9efac2036c,active,2026-11-01T00:00:00Z\n", false},
+		{"csv reordered columns", "export.CSV", "status, current_period_end, user_id\nACTIVE, 2026-11-01T00:00:00Z, 3311741c-680c-4546-99f3-fc9efac2036c\n", false},
+		{"json", "export.json", `[{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c","status":"active","current_period_end":"2026-11-01T00:00:00Z"}]`, false},
+		{"csv missing column", "export.csv", "user_id,status\n3311741c-680c-4546-99f3-fc9efac2036c,active\n", true},
+		{"csv bad user id", "export.csv", "user_id,status,current_period_end\nblonde-blazer,active,2026-11-01T00:00:00Z\n", true},
+		{"csv unknown status", "export.csv", "user_id,status,current_period_end\n3311741c-680c-4546-99f3-fc9efac2036c,paused,2026-11-01T00:00:00Z\n", true},
+		{"json unknown status", "export.json", `[{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c","status":"trialing","current_period_end":"2026-11-01T00:00:00Z"}]`, true},
+		{"json missing period", "export.json", `[{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c","status":"active"}]`, true},
+		{"other format", "export.xlsx", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memberships, err := ReadExport(strings.NewReader(tt.content), tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadExport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := Membership{UserID: userID, Status: "active", PeriodEnd: periodEnd}
+			if len(memberships) != 1 || memberships[0] != want {
+				t.Errorf("expected %+v, got %+v", want, memberships)
+			}
+		})
+	}
+}
+
+func TestReadExportStatusLine(t *testing.T) {
+	content := "user_id,status,current_period_end\n" +
+		"3311741c-680c-4546-99f3-fc9efac2036c,active,2026-11-01T00:00:00Z\n" +
+		"9ab8c6f1-6e2e-4f3c-9a27-0d1e2b8a7c55,paused,2026-11-01T00:00:00Z\n"
+	_, err := ReadExport(strings.NewReader(content), "export.csv")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected the error to point at line 3, got %v", err)
+	}
+}
+
+func TestClientMemberships(t *testing.T) {
+	pages := map[string]string{
+		"":       `{"data":[{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c","status":"active","current_period_end":"2026-11-01T00:00:00Z"}],"next_cursor":"page-2"}`,
+		"page-2": `{"data":[{"user_id":"9ab8c6f1-6e2e-4f3c-9a27-0d1e2b8a7c55","status":"cancelled","current_period_end":"2026-10-20T00:00:00Z"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/memberships" || r.Header.Get("Authorization") != "ApiKey polka-key" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("cursor")]))
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL + "/", APIKey: "polka-key", HTTP: server.Client()}
+	memberships, err := client.Memberships(context.Background())
+	if err != nil {
+		t.Fatalf("Memberships failed: %v", err)
+	}
+	if len(memberships) != 2 || memberships[1].Status != "cancelled" {
+		t.Errorf("unexpected memberships %+v", memberships)
+	}
+
+	client.APIKey = "wrong"
+	if _, err = client.Memberships(context.Background()); err == nil {
+		t.Error("expected unauthorized request to fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	later := now.Add(14 * 24 * time.Hour)
+	earlier := now.Add(-24 * time.Hour)
+
+	ids := map[string]uuid.UUID{}
+	for _, name := range []string{"ok", "missing", "unpaid", "unpaid-absent", "status", "period", "rounded", "unknown", "gone"} {
+		ids[name] = uuid.New()
+	}
+	membership := func(name, status string, periodEnd time.Time) Membership {
+		return Membership{UserID: ids[name], Status: status, PeriodEnd: periodEnd}
+	}
+
+	polkaSide := []Membership{
+		membership("ok", "active", later),
+		membership("missing", "active", later),
+		membership("unpaid", "refunded", earlier),
+		membership("status", "cancelled", later),
+		membership("period", "active", later.Add(time.Hour)),
+		membership("rounded", "active", later.Add(time.Second)),
+		membership("unknown", "active", later),
+		membership("gone", "expired", earlier),
+	}
+	localSide := []Membership{
+		membership("ok", "active", later),
+		membership("missing", "expired", earlier),
+		membership("unpaid", "active", later),
+		membership("unpaid-absent", "active", later),
+		membership("status", "active", later),
+		membership("period", "active", later),
+		membership("rounded", "active", later),
+	}
+	known := map[uuid.UUID]bool{}
+	for name, id := range ids {
+		if name != "unknown" {
+			known[id] = true
+		}
+	}
+
+	got := map[uuid.UUID]string{}
+	for _, d := range Diff(polkaSide, localSide, known, now) {
+		got[d.UserID] = d.Kind
+	}
+	want := map[string]string{
+		"missing":       KindMissing,
+		"unpaid":        KindUnpaid,
+		"unpaid-absent": KindUnpaid,
+		"status":        KindStatus,
+		"period":        KindPeriod,
+		"unknown":       KindUnknownUser,
+	}
+	if len(got) != len(want) {
+		out, _ := json.Marshal(got)
+		t.Errorf("expected %d discrepancies, got %s", len(want), out)
+	}
+	for name, kind := range want {
+		if got[ids[name]] != kind {
+			t.Errorf("%s: expected %q, got %q", name, kind, got[ids[name]])
+		}
+	}
+}
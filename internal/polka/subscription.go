@@ -0,0 +1,119 @@
+package polka
+
+import (
+	"errors"
+	"time"
+)
+
+// subscription statuses, the same words as our subscriptions table. active
+// and cancelled ones are red until the end of the period that was paid for
+// (cancelled just won't renew), the others are over
+const (
+	StatusActive    = "active"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+	StatusRefunded  = "refunded"
+)
+
+// webhook events that change a subscription
+const (
+	EventUpgraded   = "user.upgraded"
+	EventRenewed    = "subscription.renewed"
+	EventCancelled  = "subscription.cancelled"
+	EventDowngraded = "user.downgraded"
+	EventRefunded   = "payment.refunded"
+)
+
+// PeriodEnd is used when an event doesn't say when the period ends, upgrades
+// and renewals both run a calendar month
+func PeriodEnd(start time.Time) time.Time {
+	return start.AddDate(0, 1, 0)
+}
+
+var (
+	ErrNoSubscription = errors.New("no subscription to renew")
+	ErrUnknownEvent   = errors.New("unknown event")
+)
+
+// a zero PeriodEnd is open ended, see Membership
+type Subscription struct {
+	Status      string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	CancelledAt *time.Time
+}
+
+func (s Subscription) Current(now time.Time) bool {
+	return Membership{Status: s.Status, PeriodEnd: s.PeriodEnd}.Current(now)
+}
+
+// Apply returns the subscription after event. current is nil for a user
+// without one. changed is false when the event has nothing to do, like a
+// cancel for a subscription that already ended or a renewal delivered after
+// a later one
+func Apply(current *Subscription, event string, periodEnd *time.Time, now time.Time) (next Subscription, changed bool, err error) {
+	switch event {
+	case EventUpgraded:
+		next = Subscription{Status: StatusActive, PeriodStart: now, PeriodEnd: PeriodEnd(now)}
+		if periodEnd != nil {
+			next.PeriodEnd = *periodEnd
+		}
+		return next, true, nil
+
+	case EventRenewed:
+		if current == nil {
+			return Subscription{}, false, ErrNoSubscription
+		}
+		// a refund is final, only a new upgrade brings the user back
+		if current.Status == StatusRefunded {
+			return *current, false, nil
+		}
+		// out of order, a later renewal already moved the period past this one
+		if periodEnd != nil && !current.PeriodEnd.IsZero() && !periodEnd.After(current.PeriodEnd) {
+			return *current, false, nil
+		}
+		// open ended ones start now too, the zero time is long past
+		start := current.PeriodEnd
+		if start.Before(now) {
+			start = now
+		}
+		next = Subscription{Status: StatusActive, PeriodStart: start, PeriodEnd: PeriodEnd(start)}
+		if periodEnd != nil {
+			next.PeriodEnd = *periodEnd
+		}
+		return next, true, nil
+
+	case EventCancelled:
+		if current == nil || current.Status != StatusActive {
+			return Subscription{}, false, nil
+		}
+		next = *current
+		next.Status = StatusCancelled
+		next.CancelledAt = &now
+		// with no known period, red runs until the end polka sends, if any
+		if next.PeriodEnd.IsZero() {
+			next.PeriodEnd = now
+			if periodEnd != nil {
+				next.PeriodEnd = *periodEnd
+			}
+		}
+		return next, true, nil
+
+	case EventDowngraded, EventRefunded:
+		if current == nil || (current.Status != StatusActive && current.Status != StatusCancelled) {
+			return Subscription{}, false, nil
+		}
+		next = *current
+		next.Status = StatusExpired
+		if event == EventRefunded {
+			next.Status = StatusRefunded
+		}
+		if next.PeriodEnd.IsZero() || next.PeriodEnd.After(now) {
+			next.PeriodEnd = now
+		}
+		return next, true, nil
+
+	default:
+		return Subscription{}, false, ErrUnknownEvent
+	}
+}
@@ -0,0 +1,115 @@
+package polka
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApplyLifecycle(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	sub, changed, err := Apply(nil, EventUpgraded, nil, now)
+	if err != nil || !changed {
+		t.Fatalf("upgrade: changed %v, err %v", changed, err)
+	}
+	if sub.Status != StatusActive || !sub.PeriodEnd.Equal(PeriodEnd(now)) || !sub.Current(now) {
+		t.Fatalf("upgrade: unexpected %+v", sub)
+	}
+
+	// cancelled stays red until the period ends
+	sub, changed, err = Apply(&sub, EventCancelled, nil, now.Add(time.Hour))
+	if err != nil || !changed || sub.Status != StatusCancelled || sub.CancelledAt == nil {
+		t.Fatalf("cancel: unexpected %+v (changed %v, err %v)", sub, changed, err)
+	}
+	if !sub.Current(now.Add(time.Hour)) || sub.Current(sub.PeriodEnd) {
+		t.Errorf("cancel: should be red until %v", sub.PeriodEnd)
+	}
+
+	// renewing undoes the cancel and starts where the last period ended
+	oldEnd := sub.PeriodEnd
+	sub, changed, err = Apply(&sub, EventRenewed, nil, now.Add(2*time.Hour))
+	if err != nil || !changed {
+		t.Fatalf("renew: changed %v, err %v", changed, err)
+	}
+	if sub.Status != StatusActive || sub.CancelledAt != nil || !sub.PeriodStart.Equal(oldEnd) || !sub.PeriodEnd.Equal(oldEnd.AddDate(0, 1, 0)) {
+		t.Errorf("renew: unexpected %+v", sub)
+	}
+}
+
+func TestApplyRefundAfterCancel(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	cancelledAt := now.Add(-time.Hour)
+	cancelled := Subscription{Status: StatusCancelled, PeriodStart: now.Add(-24 * time.Hour), PeriodEnd: now.Add(20 * 24 * time.Hour), CancelledAt: &cancelledAt}
+
+	sub, changed, err := Apply(&cancelled, EventRefunded, nil, now)
+	if err != nil || !changed {
+		t.Fatalf("refund: changed %v, err %v", changed, err)
+	}
+	if sub.Status != StatusRefunded || !sub.PeriodEnd.Equal(now) || sub.Current(now) {
+		t.Errorf("refund: unexpected %+v", sub)
+	}
+
+	// a renewal that was still in flight doesn't bring a refund back
+	periodEnd := now.Add(40 * 24 * time.Hour)
+	if after, changed, _ := Apply(&sub, EventRenewed, &periodEnd, now); changed || after.Status != StatusRefunded {
+		t.Errorf("renew after refund: changed %v, %+v", changed, after)
+	}
+	// neither does a cancel
+	if _, changed, _ := Apply(&sub, EventCancelled, nil, now); changed {
+		t.Error("cancel after refund should not change anything")
+	}
+}
+
+func TestApplyLegacy(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	legacy := Subscription{Status: StatusActive, PeriodStart: now.AddDate(-1, 0, 0)}
+	if !legacy.Current(now.AddDate(10, 0, 0)) {
+		t.Error("legacy subscription should not run out on its own")
+	}
+
+	// the first renewal gives it a real period, whatever its end
+	periodEnd := now.Add(time.Hour)
+	sub, changed, err := Apply(&legacy, EventRenewed, &periodEnd, now)
+	if err != nil || !changed || !sub.PeriodEnd.Equal(periodEnd) {
+		t.Errorf("renew: unexpected %+v (changed %v, err %v)", sub, changed, err)
+	}
+
+	// cancelling one ends it when polka says, or now
+	sub, _, _ = Apply(&legacy, EventCancelled, &periodEnd, now)
+	if !sub.PeriodEnd.Equal(periodEnd) {
+		t.Errorf("cancel with period: ends %v, want %v", sub.PeriodEnd, periodEnd)
+	}
+	sub, _, _ = Apply(&legacy, EventCancelled, nil, now)
+	if sub.Current(now) {
+		t.Errorf("cancel without period: still red until %v", sub.PeriodEnd)
+	}
+}
+
+func TestApplyOutOfOrderRenew(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	november, december := now.AddDate(0, 1, 0), now.AddDate(0, 2, 0)
+	sub := Subscription{Status: StatusActive, PeriodStart: now, PeriodEnd: december}
+
+	// the november renewal arrives after the december one
+	after, changed, err := Apply(&sub, EventRenewed, &november, now)
+	if err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if changed || !after.PeriodEnd.Equal(december) {
+		t.Errorf("stale renewal shortened the period to %v", after.PeriodEnd)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	now := time.Now()
+	if _, _, err := Apply(nil, EventRenewed, nil, now); !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("renew without subscription: got %v", err)
+	}
+	if _, _, err := Apply(nil, "user.teleported", nil, now); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("unknown event: got %v", err)
+	}
+	if _, changed, err := Apply(nil, EventCancelled, nil, now); changed || err != nil {
+		t.Errorf("cancel without subscription: changed %v, err %v", changed, err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// login attempts are kept this long for admins to look at
+const loginAttemptRetention = 30 * 24 * time.Hour
+
+type LoginAttempt struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Email     string        `json:"email"`
+	UserID    uuid.NullUUID `json:"user_id"`
+	IP        string        `json:"ip"`
+	Success   bool          `json:"success"`
+}
+
+// behind a reverse proxy (TRUST_PROXY=true) the client is the last address
+// in X-Forwarded-For, the one our proxy appended. anything before it is
+// whatever the client felt like sending
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addrs := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) recordLoginAttempt(ctx context.Context, email string, userID uuid.NullUUID, ip string, success bool) {
+	err := cfg.dbQueries.CreateLoginAttempt(ctx, database.CreateLoginAttemptParams{
+		Email:   normalizeLoginEmail(email),
+		UserID:  userID,
+		Ip:      ip,
+		Success: success,
+	})
+	if err != nil {
+		log.Printf("could not record login attempt for %s: %v", email, err)
+	}
+}
+
+// answers 429 with Retry-After and returns true if the account or the ip has
+// to back off. a database error fails open, locking everyone out because the
+// attempts table is unhappy would be worse
+func (cfg *apiConfig) rejectThrottledLogin(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	now := time.Now()
+
+	accountFailures, err := cfg.dbQueries.GetAccountLoginFailures(r.Context(), database.GetAccountLoginFailuresParams{
+		Email: normalizeLoginEmail(email),
+		Since: now.Add(-auth.AccountThrottle.Window),
+	})
+	if err != nil {
+		log.Printf("could not check login failures for %s: %v", email, err)
+		return false
+	}
+	ipFailures, err := cfg.dbQueries.GetIPLoginFailures(r.Context(), database.GetIPLoginFailuresParams{
+		Ip:    ip,
+		Since: now.Add(-auth.IPThrottle.Window),
+	})
+	if err != nil {
+		log.Printf("could not check login failures for %s: %v", ip, err)
+		return false
+	}
+
+	retryAfter := max(
+		auth.AccountThrottle.RetryAfter(accountFailures.Failures, accountFailures.LastFailure, now),
+		auth.IPThrottle.RetryAfter(ipFailures.Failures, ipFailures.LastFailure, now),
+	)
+	if retryAfter == 0 {
+		return false
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	errorMsg := fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds)
+	log.Printf("throttled login for %s from %s", email, ip)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, errorMsg)
+	return true
+}
+
+func normalizeLoginEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 255 {
+		email = email[:255]
+	}
+	return email
+}
+
+// GET /admin/login_attempts?email=&ip=&limit=
+func (cfg *apiConfig) listLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 1000 {
+			errorMsg = "limit must be between 1 and 1000"
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	params := database.ListLoginAttemptsParams{
+		Lim: int32(limit),
+	}
+	if email := r.URL.Query().Get("email"); email != "" {
+		params.Email = sql.NullString{String: normalizeLoginEmail(email), Valid: true}
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		params.Ip = sql.NullString{String: ip, Valid: true}
+	}
+
+	dbAttempts, err := cfg.dbQueries.ListLoginAttempts(r.Context(), params)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list login attempts: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	attempts := make([]LoginAttempt, 0, len(dbAttempts))
+	for _, dbAttempt := range dbAttempts {
+		attempts = append(attempts, LoginAttempt{
+			ID:        dbAttempt.ID,
+			CreatedAt: dbAttempt.CreatedAt,
+			Email:     dbAttempt.Email,
+			UserID:    dbAttempt.UserID,
+			IP:        dbAttempt.Ip,
+			Success:   dbAttempt.Success,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, attempts); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// deletes old login attempts
+func (cfg *apiConfig) purgeLoginAttempts(ctx context.Context) error {
+	return cfg.dbQueries.DeleteLoginAttemptsBefore(ctx, time.Now().Add(-loginAttemptRetention))
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/smtp"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/chirps"
 	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/denylist"
+	"github.com/Curator4/chirpy/internal/filter"
+	"github.com/Curator4/chirpy/internal/mailer"
+	"github.com/Curator4/chirpy/internal/oidc"
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -21,20 +32,53 @@ import (
 
 const port = "8080"
 
+// access tokens
+const jwtDuration = time.Hour
+
+// emailed verification links, signed with the same keys as access tokens
+const emailVerificationDuration = 24 * time.Hour
+
+// retired signing keys have to outlive every token signed with them, the
+// longest lived are verification links
+const signedTokenMaxDuration = max(jwtDuration, emailVerificationDuration, mfaChallengeDuration)
+
+// every instance reloads signing_keys this often. a rotated key waits two
+// syncs before it signs, so everyone already accepts its tokens by then
+const signingKeySyncInterval = 30 * time.Second
+const signingKeyActivationDelay = 2 * signingKeySyncInterval
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
-	secret         string
+	signer         *auth.Signer
+	polkaSecret    []byte
 	polkaKey       string
+	mailer         mailer.Mailer
+	trustProxy     bool
+	passwordPolicy auth.PasswordPolicy
+	denylist       *denylist.Store
+	oidcProviders  map[string]*oidc.Provider
+	profanity      *filter.Filter
+	editWindow     time.Duration
+	retention      chirpRetention
+
+	// the key from JWT_SIGNING_KEY_FILE or SECRET, first in the rotation
+	// schedule, the signing_keys rows come after it
+	configSigningKey *auth.Key
+
+	// compared against when a login's email is unknown
+	dummyPasswordHash string
 }
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
 }
 
 type UserWithToken struct {
@@ -51,12 +95,47 @@ type Token struct {
 	Token string `json:"token"`
 }
 
+type TokenWithRefreshToken struct {
+	Token
+	RefreshToken string `json:"refresh_token"`
+}
+
 type Chirp struct {
 	ID        uuid.UUID     `json:"id"`
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
 	Body      string        `json:"body"`
 	UserID    uuid.NullUUID `json:"user_id"`
+	PublishAt *time.Time    `json:"publish_at,omitempty"`
+	InReplyTo *uuid.UUID    `json:"in_reply_to,omitempty"`
+	ThreadID  uuid.UUID     `json:"thread_id"`
+}
+
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	mainChirp := Chirp{
+		ID:        dbChirp.ID,
+		CreatedAt: dbChirp.CreatedAt,
+		UpdatedAt: dbChirp.UpdatedAt,
+		Body:      dbChirp.Body,
+		UserID:    dbChirp.UserID,
+		ThreadID:  dbChirp.ThreadID,
+	}
+	if dbChirp.PublishAt.Valid {
+		mainChirp.PublishAt = &dbChirp.PublishAt.Time
+	}
+	if dbChirp.InReplyTo.Valid {
+		mainChirp.InReplyTo = &dbChirp.InReplyTo.UUID
+	}
+	return mainChirp
+}
+
+// scheduled chirps show up in the timeline when they are published, not when
+// they were written
+func (c Chirp) postedAt() time.Time {
+	if c.PublishAt != nil {
+		return *c.PublishAt
+	}
+	return c.CreatedAt
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -111,6 +190,10 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cfg.rejectWeakPassword(w, params.Password, params.Email) {
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		errorMsg = fmt.Sprintf("could not hash password: %s", err)
@@ -133,13 +216,18 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// don't fail the signup over it, the user can ask for another one
+	if err = cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+		log.Printf("could not send verification email to %s: %v", dbUser.Email, err)
+	}
+
 	// map type database.User to type main.User ???
 	mainUser := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
 	}
 
 	// prepare response
@@ -155,23 +243,36 @@ func (cfg *apiConfig) chirp(w http.ResponseWriter, r *http.Request) {
 	var errorMsg string
 
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
 
-	// jwt
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		errorMsg = fmt.Sprintf("error getting jwt token: %s", err)
-		log.Print(errorMsg)
-		respondWithError(w, 500, errorMsg)
+	// jwt or api key
+	userID, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.secret)
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		errorMsg = fmt.Sprintf("invalid JWT: %v", err)
+		errorMsg = fmt.Sprintf("could not find user: %v", err)
 		log.Print(errorMsg)
 		respondWithError(w, 401, errorMsg)
+		return
+	}
+	if !dbUser.EmailVerifiedAt.Valid {
+		errorMsg = "email address has to be verified before posting"
+		log.Print(errorMsg)
+		respondWithError(w, 403, errorMsg)
+		return
+	}
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not check chirpy red: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -184,12 +285,75 @@ func (cfg *apiConfig) chirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entitlement, ok := cfg.entitlements(w, r, isChirpyRed)
+	if !ok {
+		return
+	}
+
+	body, flagged, ok := cfg.validateChirpBody(w, r, params.Body, entitlement)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectChirpRateLimit(w, r, userID, entitlement) {
+		return
+	}
+
+	var publishAt sql.NullTime
+	if params.PublishAt != nil {
+		if entitlement.MaxScheduledChirps == 0 {
+			errorMsg = fmt.Sprintf("%s accounts can't schedule chirps", entitlement.Tier)
+			log.Print(errorMsg)
+			respondWithError(w, 403, errorMsg)
+			return
+		}
+		if !params.PublishAt.After(time.Now()) || params.PublishAt.After(time.Now().Add(maxScheduleAhead)) {
+			errorMsg = fmt.Sprintf("publish_at has to be in the future and at most %v ahead", maxScheduleAhead)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+
+		scheduled, err := cfg.dbQueries.CountScheduledChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not count scheduled chirps: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		if scheduled >= int64(entitlement.MaxScheduledChirps) {
+			errorMsg = fmt.Sprintf("%s accounts can have %d chirps scheduled at a time", entitlement.Tier, entitlement.MaxScheduledChirps)
+			log.Print(errorMsg)
+			respondWithError(w, 403, errorMsg)
+			return
+		}
+		publishAt = sql.NullTime{Time: *params.PublishAt, Valid: true}
+	}
+
+	// replies join the parent's thread
+	var inReplyTo, threadID uuid.NullUUID
+	if params.InReplyTo != nil {
+		parent, err := cfg.dbQueries.GetChirp(r.Context(), *params.InReplyTo)
+		if err != nil {
+			errorMsg = fmt.Sprintf("could not find the chirp being replied to: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		threadID = uuid.NullUUID{UUID: parent.ThreadID, Valid: true}
+	}
+
 	dbChirpParams := database.CreateChirpParams{
-		Body: params.Body,
+		Body: body,
 		UserID: uuid.NullUUID{
 			UUID:  userID,
 			Valid: true,
 		},
+		PublishAt:    publishAt,
+		FlaggedWords: flagged,
+		InReplyTo:    inReplyTo,
+		ThreadID:     threadID,
 	}
 
 	dbChirp, err := cfg.dbQueries.CreateChirp(r.Context(), dbChirpParams)
@@ -200,13 +364,7 @@ func (cfg *apiConfig) chirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mainChirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
-	}
+	mainChirp := chirpFromDB(dbChirp)
 
 	if err = respondWithJSON(w, 201, mainChirp); err != nil {
 		errorMsg = fmt.Sprintf("error marshalling json: %s", err)
@@ -249,24 +407,15 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 	}
 
 	mainChirps := make([]Chirp, 0)
-	var mainChirp Chirp
-
 	for _, dbChirp := range dbChirps {
-		mainChirp = Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		}
-		mainChirps = append(mainChirps, mainChirp)
+		mainChirps = append(mainChirps, chirpFromDB(dbChirp))
 	}
 
 	//sorting
 	if sortOrder == "desc" {
-		sort.Slice(mainChirps, func(i, j int) bool { return mainChirps[j].CreatedAt.Before(mainChirps[i].CreatedAt) })
+		sort.Slice(mainChirps, func(i, j int) bool { return mainChirps[j].postedAt().Before(mainChirps[i].postedAt()) })
 	} else {
-		sort.Slice(mainChirps, func(i, j int) bool { return mainChirps[i].CreatedAt.Before(mainChirps[j].CreatedAt) })
+		sort.Slice(mainChirps, func(i, j int) bool { return mainChirps[i].postedAt().Before(mainChirps[j].postedAt()) })
 	}
 
 	if err = respondWithJSON(w, 200, mainChirps); err != nil {
@@ -295,19 +444,44 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mainChirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
-	}
+	mainChirp := chirpFromDB(dbChirp)
 
 	if err = respondWithJSON(w, 200, mainChirp); err != nil {
 		log.Print("error in marshalling..")
 	}
 }
 
+// how far ahead a chirp can be scheduled
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+// GET /api/chirps/scheduled, the caller's own chirps that aren't out yet
+func (cfg *apiConfig) listScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	dbChirps, err := cfg.dbQueries.ListScheduledChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get scheduled chirps: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	mainChirps := make([]Chirp, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		mainChirps = append(mainChirps, chirpFromDB(dbChirp))
+	}
+
+	if err = respondWithJSON(w, 200, mainChirps); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
 func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var err error
@@ -329,13 +503,24 @@ func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := cfg.clientIP(r)
+	if cfg.rejectThrottledLogin(w, r, params.Email, ip) {
+		return
+	}
+
+	// unknown emails and wrong passwords look exactly the same from outside,
+	// same response and an argon2 comparison either way so timing matches too
 	dbUser, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
-	if err != nil {
-		errorMsg = fmt.Sprintf("could not find user with email %s: %s", params.Email, err)
+	userFound := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorMsg = fmt.Sprintf("database error, could not get user: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 404, errorMsg)
+		respondWithError(w, 500, errorMsg)
 		return
 	}
+	if !userFound {
+		dbUser.HashedPassword = cfg.dummyPasswordHash
+	}
 
 	authorized, err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
 	if err != nil {
@@ -345,25 +530,68 @@ func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !authorized {
+	if !authorized || !userFound {
+		cfg.recordLoginAttempt(r.Context(), params.Email, uuid.NullUUID{UUID: dbUser.ID, Valid: userFound}, ip, false)
 		errorMsg = "Incorrect email or password"
 		log.Print(errorMsg)
 		respondWithError(w, 401, errorMsg)
 		return
 	}
 
+	// only chance to upgrade a weak (or imported bcrypt) hash, this is the one
+	// time we have the plain password. done in the background so the slow
+	// hash doesn't make this login take longer than others
+	if auth.NeedsRehash(dbUser.HashedPassword) {
+		go cfg.rehashPassword(dbUser, params.Password)
+	}
+
+	cfg.finishLogin(w, r, dbUser)
+}
+
+// the first factor checked out (password or an external provider). two
+// factor users get a challenge instead of tokens, see loginMFA
+func (cfg *apiConfig) finishLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	totpSecret, err := cfg.dbQueries.GetTOTPSecret(r.Context(), dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorMsg := fmt.Sprintf("database error, could not check two factor: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if err == nil && totpSecret.ConfirmedAt.Valid {
+		cfg.respondWithMFAChallenge(w, dbUser.ID)
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// hands out the jwt and a fresh refresh token family
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	var err error
+	var errorMsg string
+
+	cfg.recordLoginAttempt(r.Context(), dbUser.Email, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, cfg.clientIP(r), true)
+
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(r.Context(), dbUser.ID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not check chirpy red: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
 	mainUser := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   isChirpyRed,
 	}
 
 	// JWT stuff
-	jwtDuration := time.Duration(3600) * time.Second
-
-	jwtTokenString, err := auth.MakeJWT(mainUser.ID, cfg.secret, jwtDuration)
+	jwtTokenString, err := cfg.makeAccessToken(r.Context(), dbUser)
 	if err != nil {
 		errorMsg = fmt.Sprintf("error in jwt token creation %v", err)
 		log.Print(errorMsg)
@@ -376,24 +604,14 @@ func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 		Token: jwtTokenString,
 	}
 
-	refreshTokenDuration := time.Now().Add(60 * 24 * time.Hour)
-	refreshToken, err := auth.MakeRefreshToken()
+	// every login starts a new refresh token family
+	refreshToken, err := cfg.issueRefreshToken(r, cfg.dbQueries, mainUser.ID, uuid.New(), uuid.NullUUID{}, nil)
 	if err != nil {
 		errorMsg = fmt.Sprintf("error in creation of refreshtoken %v", err)
 		log.Print(errorMsg)
 		respondWithError(w, 500, errorMsg)
 		return
 	}
-	refreshTokenParams := database.CreateRefreshTokenParams{
-		Token: refreshToken,
-		UserID: uuid.NullUUID{
-			UUID:  mainUser.ID,
-			Valid: true,
-		},
-		ExpiresAt: refreshTokenDuration,
-	}
-
-	_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), refreshTokenParams)
 
 	mainUserWithRefreshToken := UserWithRefreshToken{
 		UserWithToken: mainUserWithToken,
@@ -425,22 +643,38 @@ func (cfg *apiConfig) refresh(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 401, errorMsg)
 		return
 	}
-	if refreshToken.RevokedAt.Valid {
-		errorMsg = "license has been revoked! %v"
+	// those carry the client's scopes and go through /api/oauth/token
+	if refreshToken.ClientID.Valid {
+		errorMsg = "refresh token belongs to an oauth client"
 		log.Print(errorMsg)
 		respondWithError(w, 401, errorMsg)
 		return
 	}
-	if time.Now().After(refreshToken.ExpiresAt) {
-		errorMsg = "refresh token expired: %v"
+
+	newRefreshToken, err := cfg.rotateRefreshToken(r, refreshToken)
+	if errors.Is(err, errInvalidRefreshToken) {
+		errorMsg = err.Error()
 		log.Print(errorMsg)
 		respondWithError(w, 401, errorMsg)
 		return
 	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not rotate refresh token: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), refreshToken.UserID.UUID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get user: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
 
 	// JWT stuff
-	jwtDuration := time.Duration(3600) * time.Second
-	jwtTokenString, err := auth.MakeJWT(refreshToken.UserID.UUID, cfg.secret, jwtDuration)
+	jwtTokenString, err := cfg.makeAccessToken(r.Context(), dbUser)
 	if err != nil {
 		errorMsg = fmt.Sprintf("error in jwt token creation %v", err)
 		log.Print(errorMsg)
@@ -448,16 +682,75 @@ func (cfg *apiConfig) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwtToken := Token{
-		Token: jwtTokenString,
+	tokens := TokenWithRefreshToken{
+		Token: Token{
+			Token: jwtTokenString,
+		},
+		RefreshToken: newRefreshToken,
 	}
 
-	if err = respondWithJSON(w, 200, jwtToken); err != nil {
+	if err = respondWithJSON(w, 200, tokens); err != nil {
 		errorMsg = fmt.Sprintf("error marshalling JSON %v", err)
 		log.Print(errorMsg)
 	}
 }
 
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// refresh tokens are single use, each refresh consumes the old token and hands
+// out a new one in the same family, for the same client and scopes. replaying
+// a consumed (or revoked) token means it leaked somewhere, so the whole family
+// gets revoked. errors the client caused wrap errInvalidRefreshToken
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, refreshToken database.RefreshToken) (string, error) {
+	if refreshToken.RevokedAt.Valid {
+		cfg.revokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+		log.Printf("revoked refresh token reused, revoked token family %v", refreshToken.FamilyID)
+		return "", fmt.Errorf("%w: refresh token has been revoked", errInvalidRefreshToken)
+	}
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return "", fmt.Errorf("%w: refresh token expired", errInvalidRefreshToken)
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	newRefreshToken, err := cfg.issueRefreshToken(r, qtx, refreshToken.UserID.UUID, refreshToken.FamilyID, refreshToken.ClientID, refreshToken.Scopes)
+	if err != nil {
+		return "", err
+	}
+
+	// only succeeds if the old token is still live, so two concurrent
+	// refreshes with the same token can't both win
+	_, err = qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      refreshToken.Token,
+		ReplacedBy: sql.NullString{String: newRefreshToken, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		cfg.revokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+		log.Printf("refresh token rotated twice, revoked token family %v", refreshToken.FamilyID)
+		return "", fmt.Errorf("%w: refresh token has been revoked", errInvalidRefreshToken)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return newRefreshToken, nil
+}
+
+func (cfg *apiConfig) revokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) {
+	if err := cfg.dbQueries.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		log.Printf("could not revoke refresh token family %v: %v", familyID, err)
+	}
+}
+
 func (cfg *apiConfig) revoke(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var errorMsg string
@@ -484,19 +777,8 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var errorMsg string
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		errorMsg = fmt.Sprintf("authorization error: %v", err)
-		log.Print(errorMsg)
-		respondWithError(w, http.StatusUnauthorized, errorMsg)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secret)
-	if err != nil {
-		errorMsg = fmt.Sprintf("token included but invalid: %v", err)
-		log.Print(errorMsg)
-		respondWithError(w, http.StatusUnauthorized, errorMsg)
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
 		return
 	}
 
@@ -521,6 +803,25 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cfg.rejectWeakPassword(w, params.Password, params.Email) {
+		return
+	}
+
+	oldUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get user: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	passwordUnchanged, err := auth.CheckPasswordHash(params.Password, oldUser.HashedPassword)
+	if err != nil {
+		errorMsg = fmt.Sprintf("error checking password: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		errorMsg = fmt.Sprintf("error hasing password: %v", err)
@@ -543,12 +844,36 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a new password kills every access token issued under the old one,
+	// including the one used for this request
+	if !passwordUnchanged {
+		if err = cfg.denylist.RevokeUserTokensBefore(r.Context(), userID, time.Now()); err != nil {
+			log.Printf("could not revoke access tokens for user %v: %v", userID, err)
+		}
+	}
+
+	// a new email address starts out unverified
+	if !dbUser.EmailVerifiedAt.Valid {
+		if err = cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+			log.Printf("could not send verification email to %s: %v", dbUser.Email, err)
+		}
+	}
+
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(r.Context(), dbUser.ID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not check chirpy red: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
 	mainUser := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   isChirpyRed,
 	}
 
 	if err = respondWithJSON(w, 200, mainUser); err != nil {
@@ -557,111 +882,176 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, dbUser database.User) error {
+	token, err := cfg.signer.MakeEmailVerificationToken(dbUser.ID, dbUser.Email, emailVerificationDuration)
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+			"To verify your email address, POST this token to /api/users/verify within 24 hours:\n\n%s\n", token),
+	})
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
 	var err error
 	var errorMsg string
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		errorMsg = fmt.Sprintf("authorization error: %v", err)
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, http.StatusUnauthorized, errorMsg)
+		respondWithError(w, 400, errorMsg)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secret)
+	userID, email, err := cfg.signer.ValidateEmailVerificationToken(params.Token)
 	if err != nil {
-		errorMsg = fmt.Sprintf("token included but invalid: %v", err)
+		errorMsg = fmt.Sprintf("invalid verification token: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, http.StatusUnauthorized, errorMsg)
+		respondWithError(w, 400, errorMsg)
 		return
 	}
 
-	idStr := r.PathValue("chirpID")
-	chirpID, err := uuid.Parse(idStr)
-	if err != nil {
-		errorMsg = fmt.Sprintf("invalid id: %s", err)
+	// only matches while the email is unchanged and still unverified
+	dbUser, err := cfg.dbQueries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    userID,
+		Email: email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = "verification token already used or no longer valid"
 		log.Print(errorMsg)
 		respondWithError(w, 400, errorMsg)
 		return
 	}
-
-	dbChirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		errorMsg = fmt.Sprintf("could not find chirp in db: %v", err)
+		errorMsg = fmt.Sprintf("database error, could not verify email: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 404, errorMsg)
+		respondWithError(w, 500, errorMsg)
 		return
 	}
 
-	if userID != dbChirp.UserID.UUID {
-		errorMsg = fmt.Sprintf("chirp does not belong to authenticated user: %v", err)
+	isChirpyRed, err := cfg.dbQueries.IsChirpyRed(r.Context(), dbUser.ID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not check chirpy red: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 403, errorMsg)
+		respondWithError(w, 500, errorMsg)
 		return
 	}
 
-	if err = cfg.dbQueries.DeleteChirp(r.Context(), chirpID); err != nil {
-		errorMsg = fmt.Sprintf("chirp deletion failed %v", err)
-		log.Print(errorMsg)
-		respondWithError(w, 500, errorMsg)
-		return
+	mainUser := User{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   isChirpyRed,
 	}
 
-	w.WriteHeader(204)
+	if err = respondWithJSON(w, 200, mainUser); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
 }
 
-func (cfg *apiConfig) upgradeUser(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) resendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var errorMsg string
 
-	apiKey, err := auth.GetAPIKey(r.Header)
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		errorMsg = fmt.Sprintf("failed to get apikey: %v", err)
+		errorMsg = fmt.Sprintf("could not find user: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 401, errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+	if dbUser.EmailVerifiedAt.Valid {
+		errorMsg = "email already verified"
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
 		return
 	}
 
-	if apiKey != cfg.polkaKey {
-		errorMsg = fmt.Sprintf("invalid APIKey, %v", err)
+	if err = cfg.sendVerificationEmail(r.Context(), dbUser); err != nil {
+		errorMsg = fmt.Sprintf("could not send verification email: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 401, errorMsg)
+		respondWithError(w, 500, errorMsg)
 		return
 	}
 
-	type parameters struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
+	w.WriteHeader(204)
+}
+
+// authorChirp loads the chirp in the path for its author, scheduled ones
+// included. anyone else gets a 403
+func (cfg *apiConfig) authorChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return database.Chirp{}, false
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	idStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(idStr)
 	if err != nil {
-		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		errorMsg = fmt.Sprintf("invalid id: %s", err)
 		log.Print(errorMsg)
-		respondWithError(w, 500, errorMsg)
-		return
+		respondWithError(w, 400, errorMsg)
+		return database.Chirp{}, false
 	}
 
-	if params.Data.UserID == uuid.Nil {
-		errorMsg = fmt.Sprintf("empty userID: %v", err)
+	dbChirp, err := cfg.dbQueries.GetChirpForAuthor(r.Context(), chirpID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find chirp in db: %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 500, errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return database.Chirp{}, false
+	}
+
+	if userID != dbChirp.UserID.UUID {
+		errorMsg = fmt.Sprintf("chirp %v does not belong to authenticated user", chirpID)
+		log.Print(errorMsg)
+		respondWithError(w, 403, errorMsg)
+		return database.Chirp{}, false
 	}
 
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(204)
+	return dbChirp, true
+}
+
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	dbChirp, ok := cfg.authorChirp(w, r)
+	if !ok {
 		return
 	}
 
-	if err = cfg.dbQueries.UpgradeUserByID(r.Context(), params.Data.UserID); err != nil {
-		errorMsg = fmt.Sprintf("user could not be found: %v", err)
+	// into the trash, restoreChirp can bring it back for a while
+	_, err = cfg.dbQueries.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+		ID:        dbChirp.ID,
+		DeletedBy: dbChirp.UserID,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("chirp deletion failed %v", err)
 		log.Print(errorMsg)
-		respondWithError(w, 404, errorMsg)
+		respondWithError(w, 500, errorMsg)
 		return
 	}
 
@@ -675,14 +1065,115 @@ func main() {
 	if err != nil {
 		log.Fatal("db error")
 	}
+	dbQueries := database.New(db)
 
-	apiCfg := apiConfig{
-		dbQueries: database.New(db),
-		platform:  os.Getenv("PLATFORM"),
-		secret:    os.Getenv("SECRET"),
-		polkaKey:  os.Getenv("POLKA_KEY"),
+	// commands only need the database, not the rest of the server config
+	if len(os.Args) > 1 {
+		if err = runCommand(db, dbQueries, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
+	signer, err := loadSigner()
+	if err != nil {
+		log.Fatalf("jwt key error: %v", err)
+	}
+
+	auth.PasswordParams, err = loadPasswordParams()
+	if err != nil {
+		log.Fatalf("password hashing config error: %v", err)
+	}
+	// compared against when the email is unknown, so that path costs the same
+	// argon2 work as a wrong password. made after the params are loaded so it
+	// matches the hashes being stored now
+	dummyPasswordHash, err := auth.HashPassword("chirpy-dummy-password")
+	if err != nil {
+		log.Fatalf("could not create dummy password hash: %v", err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("password policy config error: %v", err)
+	}
+
+	// POLKA_KEY is the old shared api key, still accepted for one release so
+	// upgrading doesn't break the webhook before polka signs deliveries
+	polkaKey := ""
+	if os.Getenv("POLKA_WEBHOOK_SECRET") == "" {
+		polkaKey = os.Getenv("POLKA_KEY")
+		if polkaKey == "" {
+			log.Fatal("POLKA_WEBHOOK_SECRET is required")
+		}
+		log.Print("POLKA_KEY is deprecated and will stop working in the next release, set POLKA_WEBHOOK_SECRET to have webhooks signature checked")
+	}
+
+	profanity, err := loadProfanityFilter()
+	if err != nil {
+		log.Fatalf("profanity filter config error: %v", err)
+	}
+
+	editWindow, err := loadEditWindow()
+	if err != nil {
+		log.Fatalf("chirp edit window config error: %v", err)
+	}
+
+	retention, err := loadChirpRetention()
+	if err != nil {
+		log.Fatalf("chirp retention config error: %v", err)
+	}
+
+	oidcProviders, err := loadOIDCProviders()
+	if err != nil {
+		log.Fatalf("oidc provider config error: %v", err)
+	}
+
+	// revoked access tokens, loaded up front so a restart doesn't forget them
+	tokenDenylist := denylist.New(dbQueries, jwtDuration)
+	if err = tokenDenylist.Sync(context.Background()); err != nil {
+		log.Fatalf("could not load jwt denylist: %v", err)
+	}
+	signer.SetDenylist(tokenDenylist)
+
+	apiCfg := apiConfig{
+		db:          db,
+		dbQueries:   dbQueries,
+		platform:    os.Getenv("PLATFORM"),
+		signer:      signer,
+		polkaSecret: []byte(os.Getenv("POLKA_WEBHOOK_SECRET")),
+		polkaKey:    polkaKey,
+		mailer:      loadMailer(),
+		trustProxy:  os.Getenv("TRUST_PROXY") == "true",
+
+		passwordPolicy: passwordPolicy,
+		denylist:       tokenDenylist,
+		oidcProviders:  oidcProviders,
+		profanity:      profanity,
+		editWindow:     editWindow,
+		retention:      retention,
+
+		configSigningKey: signer.Keyring().Active(),
+
+		dummyPasswordHash: dummyPasswordHash,
+	}
+
+	if err = apiCfg.syncSigningKeys(context.Background()); err != nil {
+		log.Fatalf("could not load signing keys: %v", err)
+	}
+	go runEvery(signingKeySyncInterval, "sync signing keys", apiCfg.syncSigningKeys)
+	go runEvery(time.Minute, "prune signing keys", apiCfg.pruneSigningKeys)
+	go runEvery(time.Hour, "purge login attempts", apiCfg.purgeLoginAttempts)
+	if err = apiCfg.syncProfanityWords(context.Background()); err != nil {
+		log.Fatalf("could not load profanity words: %v", err)
+	}
+	go runEvery(30*time.Second, "sync profanity words", apiCfg.syncProfanityWords)
+	go runEvery(time.Hour, "purge authorization codes", apiCfg.purgeAuthorizationCodes)
+	go runEvery(time.Hour, "purge oidc login states", apiCfg.purgeOIDCLoginStates)
+	go runEvery(24*time.Hour, "purge polka events", apiCfg.purgePolkaEvents)
+	go runEvery(time.Minute, "expire subscriptions", apiCfg.expireSubscriptions)
+	go runEvery(time.Hour, "purge deleted chirps", apiCfg.purgeDeletedChirps)
+	go runEvery(30*time.Second, "refresh jwt denylist", tokenDenylist.Refresh)
+
 	mux := http.NewServeMux()
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -694,26 +1185,403 @@ func main() {
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(app))
 
 	mux.HandleFunc("POST /api/login", apiCfg.login)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.loginMFA)
+	mux.HandleFunc("POST /api/mfa/totp", apiCfg.enrollTOTP)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.confirmTOTP)
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.disableTOTP)
 	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revoke)
+	mux.HandleFunc("GET /api/sessions", apiCfg.listSessions)
+	mux.HandleFunc("DELETE /api/sessions", apiCfg.revokeAllSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.revokeSession)
+	mux.HandleFunc("POST /api/keys", apiCfg.createAPIKey)
+	mux.HandleFunc("GET /api/keys", apiCfg.listAPIKeys)
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.revokeAPIKey)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.createOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.listOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.revokeOAuthClient)
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.describeAuthorization)
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.consentAuthorization)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.oauthToken)
+	mux.HandleFunc("GET /api/auth/{provider}/login", apiCfg.startExternalLogin)
+	mux.HandleFunc("POST /api/auth/{provider}/link", apiCfg.startExternalLink)
+	mux.HandleFunc("GET /api/auth/{provider}/callback", apiCfg.externalLoginCallback)
+	mux.HandleFunc("GET /api/identities", apiCfg.listIdentities)
+	mux.HandleFunc("DELETE /api/identities/{provider}", apiCfg.unlinkIdentity)
 	mux.HandleFunc("GET /api/healthz", ready)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwks)
 	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
-	mux.HandleFunc("POST /api/validate_chirp", validate)
+	mux.HandleFunc("GET /api/chirps/scheduled", apiCfg.listScheduledChirps)
+	mux.HandleFunc("GET /api/chirps/trash", apiCfg.listDeletedChirps)
+	mux.HandleFunc("GET /api/entitlements", apiCfg.listEntitlements)
+	mux.HandleFunc("POST /api/validate_chirp", apiCfg.validate)
 	mux.HandleFunc("POST /api/users", apiCfg.createUser)
 	mux.HandleFunc("POST /api/chirps", apiCfg.chirp)
 	mux.HandleFunc("PUT /api/users", apiCfg.updateUser)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.verifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.resendVerificationEmail)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.forgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.resetPassword)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.editChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgradeUser)
-
-	mux.HandleFunc("GET /admin/metrics", apiCfg.metrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.reset)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.listChirpRevisions)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.getThread)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/restore", apiCfg.restoreChirp)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebhook)
+
+	// everything under /admin needs a role, the first admin comes from
+	// "chirpy make-admin <email>"
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.metrics))
+	mux.HandleFunc("POST /admin/reset", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.reset))
+	mux.HandleFunc("GET /admin/keys", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.listSigningKeys))
+	mux.HandleFunc("POST /admin/keys/rotate", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.rotateSigningKey))
+	mux.HandleFunc("GET /admin/login_attempts", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.listLoginAttempts))
+	mux.HandleFunc("POST /admin/users/import", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.importUsers))
+	mux.HandleFunc("POST /admin/users/{userID}/revoke_tokens", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.revokeUserTokens))
+	mux.HandleFunc("POST /admin/tokens/revoke", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.revokeToken))
+	mux.HandleFunc("GET /admin/entitlements", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.listEntitlements))
+	mux.HandleFunc("PUT /admin/entitlements/{tier}", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.updateEntitlements))
+	mux.HandleFunc("GET /admin/billing/reconciliations", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.listBillingReconciliations))
+	mux.HandleFunc("GET /admin/profanity", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.listProfanityWords))
+	mux.HandleFunc("PUT /admin/profanity/{locale}/{word}", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.setProfanityWord))
+	mux.HandleFunc("DELETE /admin/profanity/{locale}/{word}", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.setProfanityWord))
+	mux.HandleFunc("GET /admin/chirps/flagged", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.listFlaggedChirps))
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/review", apiCfg.middlewareRole(auth.RoleModerator, apiCfg.reviewFlaggedChirp))
+	mux.HandleFunc("GET /admin/roles", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.listRoles))
+	mux.HandleFunc("GET /admin/users/{userID}/roles", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.getUserRoles))
+	mux.HandleFunc("POST /admin/users/{userID}/roles", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.grantRole))
+	mux.HandleFunc("DELETE /admin/users/{userID}/roles/{role}", apiCfg.middlewareRole(auth.RoleAdmin, apiCfg.revokeRole))
+	// anything else under /admin is a 404, but only for those allowed to know
+	mux.HandleFunc("/admin/", apiCfg.middlewareRole(auth.RoleModerator, http.NotFound))
 
 	if err := srv.ListenAndServe(); err != nil {
 		log.Fatalf("server error %v", err)
 	}
 }
 
+// jwt keys. JWT_SIGNING_KEY_FILE is an RSA or Ed25519 private key PEM, without
+// it tokens are HS256 signed with SECRET like before. JWT_VERIFY_KEYS adds
+// extra verify only keys as "kid=path.pem,kid=path.pem". to rotate via config,
+// move the old key into JWT_VERIFY_KEYS with a retire time, e.g.
+// "old=keys/old.pem@2026-11-01T00:00:00Z", and point JWT_SIGNING_KEY_FILE at
+// the new one. keys rotated in through the admin api (signing_keys) always
+// come after the config key, so once there are any, rotate there
+func loadSigner() (*auth.Signer, error) {
+	signingKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if signingKeyFile == "" {
+		secret := os.Getenv("SECRET")
+		if secret == "" {
+			return nil, errors.New("need either SECRET or JWT_SIGNING_KEY_FILE")
+		}
+		return auth.NewSigner(auth.NewHMACKey("default", []byte(secret)))
+	}
+
+	data, err := os.ReadFile(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	activeKey, err := auth.ParsePrivateKeyPEM(os.Getenv("JWT_SIGNING_KID"), data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	keyring, err := auth.NewKeyring(activeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, found := strings.Cut(entry, "=")
+		if !found {
+			kid, path = "", entry
+		}
+		path, retireAtStr, hasRetireAt := strings.Cut(path, "@")
+		var retireAt time.Time
+		if hasRetireAt {
+			retireAt, err = time.Parse(time.RFC3339, retireAtStr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid retire time: %w", path, err)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := auth.ParsePublicKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err = keyring.AddVerifyKey(key, retireAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.NewSignerFromKeyring(keyring), nil
+}
+
+// argon2id parameters for new hashes, ARGON2_MEMORY is in KiB. anything
+// unset keeps the library default. raising them upgrades existing hashes as
+// users log in
+func loadPasswordParams() (*argon2id.Params, error) {
+	params := *argon2id.DefaultParams
+
+	for _, setting := range []struct {
+		env  string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	} {
+		valueStr := os.Getenv(setting.env)
+		if valueStr == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(valueStr, 10, setting.bits)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid %s %q", setting.env, valueStr)
+		}
+		setting.set(value)
+	}
+
+	return &params, nil
+}
+
+// PASSWORD_MIN_LENGTH and PASSWORD_MIN_ENTROPY override the defaults,
+// BREACHED_PASSWORDS points at a SHA-1 hash file or a k-anonymity prefix
+// directory, see auth.LoadBreachedPasswords
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	if minLengthStr := os.Getenv("PASSWORD_MIN_LENGTH"); minLengthStr != "" {
+		minLength, err := strconv.Atoi(minLengthStr)
+		if err != nil {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", minLengthStr)
+		}
+		policy.MinLength = minLength
+	}
+	if minEntropyStr := os.Getenv("PASSWORD_MIN_ENTROPY"); minEntropyStr != "" {
+		minEntropy, err := strconv.ParseFloat(minEntropyStr, 64)
+		if err != nil {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_ENTROPY %q", minEntropyStr)
+		}
+		policy.MinEntropyBits = minEntropy
+	}
+	if breachedPath := os.Getenv("BREACHED_PASSWORDS"); breachedPath != "" {
+		breached, err := auth.LoadBreachedPasswords(breachedPath)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// mail delivery. MAILER is "smtp" (SMTP_ADDR, SMTP_USER, SMTP_PASSWORD),
+// "file" (writes .eml files to MAIL_DIR) or "log", the default, which only
+// logs bodies with PLATFORM=dev
+func loadMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		var smtpAuth smtp.Auth
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			smtpAuth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mailer.SMTPMailer{Addr: addr, Auth: smtpAuth, From: from}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return mailer.FileMailer{Dir: dir, From: from}
+	}
+	if os.Getenv("PLATFORM") != "dev" {
+		log.Print("no MAILER configured, emails are logged without their body and won't reach anyone")
+	}
+	return mailer.LogMailer{ShowBody: os.Getenv("PLATFORM") == "dev"}
+}
+
+// external login providers. OIDC_PROVIDERS is a comma separated list of
+// names, each configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET
+// and _REDIRECT_URL (which has to end up at /api/auth/<name>/callback)
+func loadOIDCProviders() (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       []string{"email"},
+		}
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+		providers[name] = oidc.NewProvider(config, nil)
+	}
+	return providers, nil
+}
+
+// runs job every interval for the lifetime of the server. each run gets at
+// most one interval, so a hung query can't hold up the next one forever
+func runEvery(interval time.Duration, name string, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := job(ctx); err != nil {
+			log.Printf("could not %s: %v", name, err)
+		}
+		cancel()
+	}
+}
+
+// drops retired jwt keys, from the keyring and from signing_keys
+func (cfg *apiConfig) pruneSigningKeys(ctx context.Context) error {
+	now := time.Now()
+	for _, kid := range cfg.signer.Keyring().Prune(now) {
+		log.Printf("retired jwt signing key %s", kid)
+	}
+	return cfg.dbQueries.DeleteReplacedSigningKeys(ctx, now.Add(-signedTokenMaxDuration-time.Minute))
+}
+
+// loads signing_keys into the keyring, including rotations other instances
+// made
+func (cfg *apiConfig) syncSigningKeys(ctx context.Context) error {
+	dbKeys, err := cfg.dbQueries.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	schedule := []auth.ScheduledKey{{Key: cfg.configSigningKey}}
+	for _, dbKey := range dbKeys {
+		key, err := auth.ParsePrivateKeyPEM(dbKey.Kid, []byte(dbKey.PrivateKeyPem))
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", dbKey.Kid, err)
+		}
+		schedule = append(schedule, auth.ScheduledKey{Key: key, ActivateAt: dbKey.ActivatesAt})
+	}
+	// the old key has to outlive every token it signed
+	return cfg.signer.Keyring().Schedule(schedule, signedTokenMaxDuration+time.Minute, time.Now())
+}
+
+func (cfg *apiConfig) listSigningKeys(w http.ResponseWriter, _ *http.Request) {
+	if err := respondWithJSON(w, 200, cfg.signer.Keyring().Keys()); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// rotates the jwt signing key. takes an optional PEM private key, otherwise
+// generates one. the key goes into signing_keys so it survives restarts and
+// reaches the other instances, it starts signing after
+// signingKeyActivationDelay
+func (cfg *apiConfig) rotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		KeyID         string `json:"kid"`
+		Algorithm     string `json:"alg"`
+		PrivateKeyPEM string `json:"private_key_pem"`
+	}
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err = decoder.Decode(&params); err != nil {
+			errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	var newKey *auth.Key
+	if params.PrivateKeyPEM != "" {
+		newKey, err = auth.ParsePrivateKeyPEM(params.KeyID, []byte(params.PrivateKeyPEM))
+	} else {
+		newKey, err = auth.GenerateKey(params.KeyID, params.Algorithm)
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid signing key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if _, exists := cfg.signer.Keyring().Lookup(newKey.ID); exists {
+		errorMsg = fmt.Sprintf("duplicate key id %q", newKey.ID)
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
+		return
+	}
+	pemData, err := newKey.PrivateKeyPEM()
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid signing key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	activateAt := time.Now().Add(signingKeyActivationDelay)
+	rows, err := cfg.dbQueries.CreateSigningKey(r.Context(), database.CreateSigningKeyParams{
+		Kid:           newKey.ID,
+		PrivateKeyPem: string(pemData),
+		ActivatesAt:   activateAt,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not save signing key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if rows == 0 {
+		errorMsg = fmt.Sprintf("duplicate key id %q", newKey.ID)
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
+		return
+	}
+	if err = cfg.syncSigningKeys(r.Context()); err != nil {
+		errorMsg = fmt.Sprintf("could not load signing key: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	log.Printf("jwt signing key %s takes over at %v", newKey.ID, activateAt)
+
+	if err = respondWithJSON(w, 200, cfg.signer.Keyring().Keys()); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+func (cfg *apiConfig) jwks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := respondWithJSON(w, 200, cfg.signer.JWKS()); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
 func ready(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -721,7 +1589,8 @@ func ready(w http.ResponseWriter, _ *http.Request) {
 }
 
 // encode/decode json
-func validate(w http.ResponseWriter, r *http.Request) {
+// anyone can validate, a logged in user is checked against their own limits
+func (cfg *apiConfig) validate(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var errorMsg string
 	var err error
@@ -746,17 +1615,35 @@ func validate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check length
-	if len(params.Body) > 140 {
-		errorMsg = "chirp is too long"
-		log.Print(errorMsg)
-		respondWithError(w, 400, errorMsg)
+	isChirpyRed := false
+	if r.Header.Get("Authorization") != "" {
+		userID, ok := cfg.authorize(w, r, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+		isChirpyRed, err = cfg.dbQueries.IsChirpyRed(r.Context(), userID)
+		if err != nil {
+			errorMsg = fmt.Sprintf("could not find user: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 401, errorMsg)
+			return
+		}
+	}
+
+	entitlement, ok := cfg.entitlements(w, r, isChirpyRed)
+	if !ok {
+		return
+	}
+
+	// same checks as posting it
+	body, _, ok := cfg.validateChirpBody(w, r, params.Body, entitlement)
+	if !ok {
 		return
 	}
 
 	// prepare response, marshal, send with helper
 	respBody := returnVals{
-		CleanedBody: censorProfanity(params.Body),
+		CleanedBody: body,
 	}
 	if err = respondWithJSON(w, 200, respBody); err != nil {
 		errorMsg = fmt.Sprintf("error marshalling JSON: %s", err)
@@ -764,6 +1651,45 @@ func validate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// refresh token helper, q can be a transaction. the request's user agent and
+// ip are stored with the token for the session list
+// clientID and scopes are only set for tokens issued to an oauth client
+func (cfg *apiConfig) issueRefreshToken(r *http.Request, q *database.Queries, userID, familyID uuid.UUID, clientID uuid.NullUUID, scopes []string) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	// postgres only takes valid UTF-8, so never cut a character in half
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+	if len(userAgent) > 512 {
+		cut := 512
+		for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+			cut--
+		}
+		userAgent = userAgent[:cut]
+	}
+
+	_, err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token: refreshToken,
+		UserID: uuid.NullUUID{
+			UUID:  userID,
+			Valid: true,
+		},
+		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		FamilyID:  familyID,
+		UserAgent: userAgent,
+		Ip:        cfg.clientIP(r),
+		ClientID:  clientID,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
 // json helpers
 func respondWithJSON(w http.ResponseWriter, code int, payload any) error {
 	response, err := json.Marshal(payload)
@@ -781,18 +1707,29 @@ func respondWithError(w http.ResponseWriter, code int, msg string) error {
 	return respondWithJSON(w, code, map[string]string{"error": msg})
 }
 
-// profanity helper, should have used map here ofc for O(1)
-func censorProfanity(body string) string {
-	badWords := [3]string{"kerfuffle", "sharbert", "fornax"}
-	splitBody := strings.Split(body, " ")
+// like respondWithError but also lists which rules failed
+func respondWithViolations(w http.ResponseWriter, code int, msg string, violations any) error {
+	return respondWithJSON(w, code, map[string]any{"error": msg, "violations": violations})
+}
 
-	for i, element := range splitBody {
-		for _, badWord := range badWords {
-			if strings.ToLower(element) == badWord {
-				splitBody[i] = "****"
-			}
+// validateChirpBody runs the chirps pipeline with the user's length limit and
+// returns the body to store, and the words to flag it for if the profanity
+// filter is in flag mode. answers 400 with every violated rule itself
+func (cfg *apiConfig) validateChirpBody(w http.ResponseWriter, r *http.Request, body string, entitlement database.Entitlement) (string, []string, bool) {
+	var flagged []string
+	pipeline := chirps.New(int(entitlement.MaxChirpLength), cfg.profanityRule(r, &flagged))
+	body, err := pipeline.Validate(body)
+	if err != nil {
+		var validationErr *chirps.ValidationError
+		if errors.As(err, &validationErr) {
+			log.Print(validationErr.Error())
+			respondWithViolations(w, 400, "chirp is not valid", validationErr.Violations)
+			return "", nil, false
 		}
+		errorMsg := fmt.Sprintf("could not validate chirp: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return "", nil, false
 	}
-
-	return strings.Join(splitBody, " ")
+	return body, flagged, true
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const mfaChallengeDuration = 5 * time.Minute
+
+const recoveryCodeCount = 10
+
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	var err error
+	var errorMsg string
+
+	mfaToken, err := cfg.signer.MakeMFAChallengeToken(userID, mfaChallengeDuration)
+	if err != nil {
+		errorMsg = fmt.Sprintf("error in mfa token creation %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	challenge := MFAChallenge{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}
+
+	if err = respondWithJSON(w, 200, challenge); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// second half of login for two factor users, trades the challenge from
+// /api/login plus a totp or recovery code for the usual tokens
+func (cfg *apiConfig) loginMFA(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	userID, err := cfg.signer.ValidateMFAChallengeToken(params.MFAToken)
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid mfa token: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find user: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	// codes are only 6 digits, they get throttled just like passwords
+	ip := cfg.clientIP(r)
+	if cfg.rejectThrottledLogin(w, r, dbUser.Email, ip) {
+		return
+	}
+
+	ok, err := checkSecondFactor(r.Context(), cfg.dbQueries, userID, params.Code, params.RecoveryCode)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not check second factor: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if !ok {
+		cfg.recordLoginAttempt(r.Context(), dbUser.Email, uuid.NullUUID{UUID: userID, Valid: true}, ip, false)
+		errorMsg = "invalid two factor code"
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// checks a totp code or, if that's empty, a recovery code. both are used up
+// on success, a totp code can't be replayed within its time window
+func checkSecondFactor(ctx context.Context, q *database.Queries, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		if recoveryCode == "" {
+			return false, nil
+		}
+		_, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   userID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	totpSecret, err := q.GetTOTPSecret(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !totpSecret.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	step, ok, err := auth.ValidateTOTP(totpSecret.Secret, code, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	_, err = q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("replayed totp code for user %v", userID)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// starts enrollment, the secret only counts once confirmTOTP has seen a code
+// from it. calling this again before confirming replaces the secret
+func (cfg *apiConfig) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find user: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		errorMsg = fmt.Sprintf("error generating totp secret: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	_, err = cfg.dbQueries.UpsertTOTPSecret(r.Context(), database.UpsertTOTPSecretParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = "two factor already enabled, disable it first"
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
+		return
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not store totp secret: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	type returnVals struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+	}
+
+	respBody := returnVals{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(secret, "Chirpy", dbUser.Email),
+	}
+	if err = respondWithJSON(w, 201, respBody); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// turns two factor on and hands out the recovery codes, the only time they
+// are ever shown
+func (cfg *apiConfig) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	totpSecret, err := cfg.dbQueries.GetTOTPSecret(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("no totp enrollment found: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+	if totpSecret.ConfirmedAt.Valid {
+		errorMsg = "two factor already enabled"
+		log.Print(errorMsg)
+		respondWithError(w, 409, errorMsg)
+		return
+	}
+
+	step, ok, err := auth.ValidateTOTP(totpSecret.Secret, params.Code, time.Now())
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not check totp code: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if !ok {
+		errorMsg = "invalid totp code"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		errorMsg = fmt.Sprintf("error generating recovery codes: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.ConfirmTOTPSecret(r.Context(), database.ConfirmTOTPSecretParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not confirm totp: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not clear recovery codes: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	for _, code := range recoveryCodes {
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+			UserID:   userID,
+		})
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not store recovery code: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit totp: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	type returnVals struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	if err = respondWithJSON(w, 200, returnVals{RecoveryCodes: recoveryCodes}); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// turning two factor off needs a current code, a stolen jwt alone isn't enough
+func (cfg *apiConfig) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	valid, err := checkSecondFactor(r.Context(), qtx, userID, params.Code, params.RecoveryCode)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not check second factor: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if !valid {
+		errorMsg = "invalid two factor code"
+		log.Print(errorMsg)
+		respondWithError(w, 403, errorMsg)
+		return
+	}
+
+	if err = qtx.DeleteTOTPSecret(r.Context(), userID); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not delete totp secret: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if err = qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not delete recovery codes: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chirpy as an OAuth2 authorization server (RFC 6749), authorization code
+// grant only, PKCE (RFC 7636, S256) required for every client. the frontend
+// does the user facing part: it shows what GET /api/oauth/authorize describes
+// and posts the user's answer back, then sends the browser to redirect_to
+
+const authorizationCodeDuration = 10 * time.Minute
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+}
+
+type OAuthClientWithSecret struct {
+	OAuthClient
+	Secret string `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Scopes:       dbClient.Scopes,
+		Public:       !dbClient.SecretHash.Valid,
+	}
+}
+
+// POST /api/oauth/clients. public clients (native and browser apps) can't
+// keep a secret and get none, PKCE is all they have
+func (cfg *apiConfig) createOAuthClient(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.Name == "" || len(params.Name) > 100 {
+		errorMsg = "name is required and at most 100 characters"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		errorMsg = "at least one redirect uri is required"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if !auth.ValidRedirectURI(uri) {
+			errorMsg = fmt.Sprintf("invalid redirect uri %q, has to be https (or http on localhost) without a fragment", uri)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+	if err = auth.ValidateScopes(params.Scopes, auth.DelegatedScopes); err != nil {
+		errorMsg = fmt.Sprintf("invalid scopes: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if !params.Public {
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			errorMsg = fmt.Sprintf("error generating client secret: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       params.Scopes,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not create oauth client: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	response := OAuthClientWithSecret{
+		OAuthClient: oauthClientFromDB(dbClient),
+		Secret:      secret,
+	}
+
+	if err = respondWithJSON(w, 201, response); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+func (cfg *apiConfig) listOAuthClients(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	dbClients, err := cfg.dbQueries.ListUserOAuthClients(r.Context(), userID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list oauth clients: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(dbClients))
+	for _, dbClient := range dbClients {
+		clients = append(clients, oauthClientFromDB(dbClient))
+	}
+
+	if err = respondWithJSON(w, 200, clients); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// deleting a client also ends every grant users gave it
+func (cfg *apiConfig) revokeOAuthClient(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeUserOAuthClient(r.Context(), database.RevokeUserOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke oauth client: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if revoked == 0 {
+		errorMsg = "no active oauth client with that id"
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	if err = cfg.dbQueries.RevokeOAuthClientRefreshTokens(r.Context(), uuid.NullUUID{UUID: clientID, Valid: true}); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke oauth client tokens: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// the parameters of an authorization request, RFC 6749 section 4.1.1 plus
+// PKCE. the frontend passes them through from the client's redirect
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// checks the request against the registered client, returns the client and
+// the scopes being asked for (all the client's if none are named)
+func (cfg *apiConfig) validateAuthorizationRequest(ctx context.Context, req authorizationRequest) (database.OauthClient, []string, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, nil, errors.New("unknown client_id")
+	}
+	dbClient, err := cfg.dbQueries.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, nil, errors.New("unknown client_id")
+	}
+	if err != nil {
+		return database.OauthClient{}, nil, err
+	}
+
+	// exact match only, anything looser is how codes get stolen
+	if !slices.Contains(dbClient.RedirectUris, req.RedirectURI) {
+		return database.OauthClient{}, nil, errors.New("redirect_uri is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return database.OauthClient{}, nil, errors.New("response_type must be code")
+	}
+	if req.CodeChallengeMethod != "S256" || !auth.ValidCodeChallenge(req.CodeChallenge) {
+		return database.OauthClient{}, nil, errors.New("a code_challenge with code_challenge_method S256 is required")
+	}
+
+	scopes := auth.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = dbClient.Scopes
+	}
+	if err = auth.ValidateScopes(scopes, dbClient.Scopes); err != nil {
+		return database.OauthClient{}, nil, err
+	}
+
+	return dbClient, scopes, nil
+}
+
+// GET /api/oauth/authorize, tells the frontend what to put on the consent
+// screen. consented means the user already agreed to these scopes before
+func (cfg *apiConfig) describeAuthorization(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	req := authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	dbClient, scopes, err := cfg.validateAuthorizationRequest(r.Context(), req)
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid authorization request: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	consented := false
+	consent, err := cfg.dbQueries.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: dbClient.ID,
+	})
+	if err == nil {
+		consented = auth.ValidateScopes(scopes, consent.Scopes) == nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errorMsg = fmt.Sprintf("database error, could not get consent: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	type response struct {
+		ClientID    uuid.UUID `json:"client_id"`
+		ClientName  string    `json:"client_name"`
+		RedirectURI string    `json:"redirect_uri"`
+		Scopes      []string  `json:"scopes"`
+		Consented   bool      `json:"consented"`
+	}
+
+	if err = respondWithJSON(w, 200, response{
+		ClientID:    dbClient.ID,
+		ClientName:  dbClient.Name,
+		RedirectURI: req.RedirectURI,
+		Scopes:      scopes,
+		Consented:   consented,
+	}); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// POST /api/oauth/authorize, the consent. takes the authorization request
+// plus "approve", answers with where to send the browser: the redirect uri
+// with a code, or with error=access_denied
+func (cfg *apiConfig) consentAuthorization(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	dbClient, scopes, err := cfg.validateAuthorizationRequest(r.Context(), params.authorizationRequest)
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid authorization request: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	redirectParams := url.Values{}
+	if params.State != "" {
+		redirectParams.Set("state", params.State)
+	}
+
+	if !params.Approve {
+		redirectParams.Set("error", "access_denied")
+		respondWithRedirect(w, params.RedirectURI, redirectParams)
+		return
+	}
+
+	code, err := auth.MakeOpaqueToken()
+	if err != nil {
+		errorMsg = fmt.Sprintf("error generating authorization code: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	err = cfg.dbQueries.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      dbClient.ID,
+		UserID:        userID,
+		RedirectUri:   params.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: params.CodeChallenge,
+		FamilyID:      uuid.New(),
+		ExpiresAt:     time.Now().Add(authorizationCodeDuration),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not create authorization code: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	err = cfg.dbQueries.SaveOAuthConsent(r.Context(), database.SaveOAuthConsentParams{
+		UserID:   userID,
+		ClientID: dbClient.ID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		log.Printf("could not save consent of user %v for client %v: %v", userID, dbClient.ID, err)
+	}
+
+	redirectParams.Set("code", code)
+	respondWithRedirect(w, params.RedirectURI, redirectParams)
+}
+
+func respondWithRedirect(w http.ResponseWriter, redirectURI string, params url.Values) {
+	// registered uris are valid, keep whatever query they came with
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	if err := respondWithJSON(w, 200, response{RedirectTo: u.String()}); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// token endpoint errors have their own shape, RFC 6749 section 5.2
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthError, description string) {
+	log.Printf("oauth token error %s: %s", oauthError, description)
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	type errorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := respondWithJSON(w, code, errorResponse{Error: oauthError, ErrorDescription: description}); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// confidential clients authenticate with HTTP Basic or client_secret in the
+// form, public ones just name themselves
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientIDStr, secret, hasBasic := r.BasicAuth()
+	if hasBasic {
+		// the basic auth parts are form encoded, RFC 6749 section 2.3.1
+		clientIDStr, _ = url.QueryUnescape(clientIDStr)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientIDStr = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDStr)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	dbClient, err := cfg.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if dbClient.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(dbClient.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errors.New("invalid client secret")
+		}
+	}
+	return dbClient, nil
+}
+
+// POST /api/oauth/token, form encoded like the spec says
+func (cfg *apiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, 400, "invalid_request", fmt.Sprintf("could not parse form: %v", err))
+		return
+	}
+
+	dbClient, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		respondWithOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, dbClient)
+	case "refresh_token":
+		cfg.refreshOAuthToken(w, r, dbClient)
+	default:
+		respondWithOAuthError(w, 400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, dbClient database.OauthClient) {
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not start transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	authCode, err := qtx.UseAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		// a code used twice was intercepted, whatever the first use got
+		// is revoked, RFC 6749 section 4.1.2
+		if usedCode, err := cfg.dbQueries.GetAuthorizationCode(r.Context(), codeHash); err == nil && usedCode.UsedAt.Valid {
+			cfg.revokeRefreshTokenFamily(r.Context(), usedCode.FamilyID)
+			log.Printf("authorization code reused, revoked token family %v", usedCode.FamilyID)
+		}
+		respondWithOAuthError(w, 400, "invalid_grant", "authorization code is invalid, expired or already used")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not use authorization code: %v", err))
+		return
+	}
+
+	if authCode.ClientID != dbClient.ID {
+		respondWithOAuthError(w, 400, "invalid_grant", "authorization code was issued to another client")
+		return
+	}
+	if authCode.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, 400, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), authCode.CodeChallenge) {
+		respondWithOAuthError(w, 400, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	refreshToken, err := cfg.issueRefreshToken(r, qtx, authCode.UserID, authCode.FamilyID, uuid.NullUUID{UUID: dbClient.ID, Valid: true}, authCode.Scopes)
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not create refresh token: %v", err))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not commit authorization code: %v", err))
+		return
+	}
+
+	cfg.respondWithOAuthTokens(w, r, authCode.UserID, dbClient.ID, authCode.Scopes, refreshToken)
+}
+
+func (cfg *apiConfig) refreshOAuthToken(w http.ResponseWriter, r *http.Request, dbClient database.OauthClient) {
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(r.Context(), r.PostForm.Get("refresh_token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, 400, "invalid_grant", "no refresh token found")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not get refresh token: %v", err))
+		return
+	}
+	// checked before rotating, another client must not be able to burn it
+	if refreshToken.ClientID.UUID != dbClient.ID {
+		respondWithOAuthError(w, 400, "invalid_grant", "refresh token was issued to another client")
+		return
+	}
+
+	newRefreshToken, err := cfg.rotateRefreshToken(r, refreshToken)
+	if errors.Is(err, errInvalidRefreshToken) {
+		respondWithOAuthError(w, 400, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not rotate refresh token: %v", err))
+		return
+	}
+
+	cfg.respondWithOAuthTokens(w, r, refreshToken.UserID.UUID, dbClient.ID, refreshToken.Scopes, newRefreshToken)
+}
+
+// RFC 6749 section 5.1
+func (cfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, r *http.Request, userID, clientID uuid.UUID, scopes []string, refreshToken string) {
+	dbUser, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not get user: %v", err))
+		return
+	}
+
+	accessToken, err := cfg.makeScopedAccessToken(r.Context(), dbUser, scopes, clientID.String())
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", fmt.Sprintf("could not create access token: %v", err))
+		return
+	}
+
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err = respondWithJSON(w, 200, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwtDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// deletes authorization codes a day after they expired, the day is for
+// spotting reuse
+func (cfg *apiConfig) purgeAuthorizationCodes(ctx context.Context) error {
+	return cfg.dbQueries.DeleteExpiredAuthorizationCodes(ctx, time.Now().Add(-24*time.Hour))
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const passwordResetDuration = time.Hour
+
+// always answers 202, whether or not the email belongs to an account, so this
+// can't be used to find out who has one
+func (cfg *apiConfig) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	// looking the account up, storing the token and mailing it all take time
+	// only when the account exists, so none of it happens before answering
+	go cfg.sendPasswordReset(params.Email)
+
+	w.WriteHeader(202)
+}
+
+// the background half of forgotPassword, failures only show up in the log
+func (cfg *apiConfig) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the address stays out of the log, anyone can submit any address here
+	dbUser, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Print("password reset requested for an unknown email")
+		return
+	}
+	if err != nil {
+		log.Printf("database error, could not look up password reset email: %v", err)
+		return
+	}
+
+	resetToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		log.Printf("error in creation of reset token %v", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(resetToken),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(passwordResetDuration),
+	})
+	if err != nil {
+		log.Printf("database error, could not create reset token for %v: %v", dbUser.ID, err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"To pick a new one, POST this token with your new password to /api/password/reset within an hour:\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n", resetToken),
+	})
+	if err != nil {
+		log.Printf("could not send reset email to %v: %v", dbUser.ID, err)
+	}
+}
+
+// sets the new password and logs the user out everywhere
+func (cfg *apiConfig) resetPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.Token == "" || params.Password == "" {
+		errorMsg = "need both token and password fields"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if cfg.rejectWeakPassword(w, params.Password) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		errorMsg = fmt.Sprintf("error hashing password: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	resetToken, err := qtx.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMsg = "reset token is invalid, expired or already used"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not use reset token: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	_, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             resetToken.UserID,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not update password: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = qtx.InvalidatePasswordResetTokens(r.Context(), resetToken.UserID); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not invalidate reset tokens: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = qtx.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: resetToken.UserID, Valid: true}); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke refresh tokens: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit password reset: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	if err = cfg.denylist.RevokeUserTokensBefore(r.Context(), resetToken.UserID, time.Now()); err != nil {
+		log.Printf("could not revoke access tokens for user %v: %v", resetToken.UserID, err)
+	}
+
+	w.WriteHeader(204)
+}
+
+// swaps a stored hash for one made with the current PasswordParams. failing
+// here is not worth failing the login over, it'll be tried again next time
+func (cfg *apiConfig) rehashPassword(dbUser database.User, password string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	newHash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("could not rehash password for user %v: %v", dbUser.ID, err)
+		return
+	}
+
+	err = cfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: newHash,
+		ID:      dbUser.ID,
+		OldHash: dbUser.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("could not store rehashed password for user %v: %v", dbUser.ID, err)
+		return
+	}
+	log.Printf("upgraded password hash for user %v", dbUser.ID)
+}
+
+// imports users from another system with their existing password hashes,
+// bcrypt or argon2id. existing emails are skipped, not overwritten
+func (cfg *apiConfig) importUsers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type importedUser struct {
+		Email         string `json:"email"`
+		PasswordHash  string `json:"password_hash"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+
+	type parameters struct {
+		Users []importedUser `json:"users"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	for i, user := range params.Users {
+		if user.Email == "" || !auth.IsSupportedPasswordHash(user.PasswordHash) {
+			errorMsg = fmt.Sprintf("user %d: need an email and a bcrypt or argon2id password_hash", i)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	type returnVals struct {
+		Imported []User   `json:"imported"`
+		Skipped  []string `json:"skipped"`
+	}
+	respBody := returnVals{
+		Imported: make([]User, 0, len(params.Users)),
+		Skipped:  make([]string, 0),
+	}
+
+	for _, user := range params.Users {
+		dbUser, err := cfg.dbQueries.ImportUser(r.Context(), database.ImportUserParams{
+			Email:           user.Email,
+			HashedPassword:  user.PasswordHash,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: user.EmailVerified},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respBody.Skipped = append(respBody.Skipped, user.Email)
+			continue
+		}
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not import %s: %v", user.Email, err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+
+		respBody.Imported = append(respBody.Imported, User{
+			ID:            dbUser.ID,
+			CreatedAt:     dbUser.CreatedAt,
+			UpdatedAt:     dbUser.UpdatedAt,
+			Email:         dbUser.Email,
+			EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, respBody); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+// answers 400 with the failed rules and returns true if the password doesn't
+// meet the policy
+func (cfg *apiConfig) rejectWeakPassword(w http.ResponseWriter, password string, userInputs ...string) bool {
+	err := cfg.passwordPolicy.Check(password, userInputs...)
+	if err == nil {
+		return false
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		log.Print(policyErr.Error())
+		respondWithViolations(w, 400, "password does not meet the password policy", policyErr.Violations)
+		return true
+	}
+
+	errorMsg := fmt.Sprintf("could not check password: %v", err)
+	log.Print(errorMsg)
+	respondWithError(w, 500, errorMsg)
+	return true
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/chirps"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/filter"
+	"github.com/google/uuid"
+	"golang.org/x/text/language"
+)
+
+// chirps are checked against the lists for the languages the client accepts,
+// plus english since that is what most of chirpy is written in
+const siteLocale = "en"
+
+// word lists come from PROFANITY_DIR (default ./profanity, <locale>.txt
+// files), PROFANITY_MODE is mask, reject or flag
+func loadProfanityFilter() (*filter.Filter, error) {
+	mode := filter.ModeMask
+	if modeStr := os.Getenv("PROFANITY_MODE"); modeStr != "" {
+		var err error
+		if mode, err = filter.ParseMode(modeStr); err != nil {
+			return nil, err
+		}
+	}
+
+	profanity := filter.New(mode)
+	dir := os.Getenv("PROFANITY_DIR")
+	if dir == "" {
+		dir = "profanity"
+	}
+	if err := profanity.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	if len(profanity.Locales()) == 0 {
+		log.Printf("no word lists in %s, chirps are not filtered until an admin adds words", dir)
+	}
+	return profanity, nil
+}
+
+func chirpLocales(r *http.Request) []string {
+	locales := []string{siteLocale}
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	for _, tag := range tags {
+		base, _ := tag.Base()
+		if base.String() != "und" {
+			locales = append(locales, base.String())
+		}
+	}
+	return locales
+}
+
+// profanityRule is the filter as a step of the chirps pipeline. in flag mode
+// the chirp passes and the matches end up in flagged
+func (cfg *apiConfig) profanityRule(r *http.Request, flagged *[]string) chirps.Rule {
+	locales := chirpLocales(r)
+	return func(body string) (string, *chirps.Violation) {
+		masked, matches := cfg.profanity.Check(body, locales...)
+		if matches == nil {
+			return body, nil
+		}
+		switch cfg.profanity.Mode() {
+		case filter.ModeReject:
+			return body, &chirps.Violation{
+				Rule:    "profanity",
+				Message: fmt.Sprintf("chirp contains words that aren't allowed: %s", strings.Join(matches, ", ")),
+			}
+		case filter.ModeFlag:
+			*flagged = matches
+			return body, nil
+		default:
+			return masked, nil
+		}
+	}
+}
+
+// admins' changes are in the database so every instance picks them up
+func (cfg *apiConfig) syncProfanityWords(ctx context.Context) error {
+	dbWords, err := cfg.dbQueries.ListProfanityWords(ctx)
+	if err != nil {
+		return err
+	}
+	added, removed := map[string][]string{}, map[string][]string{}
+	for _, dbWord := range dbWords {
+		if dbWord.Listed {
+			added[dbWord.Locale] = append(added[dbWord.Locale], dbWord.Word)
+		} else {
+			removed[dbWord.Locale] = append(removed[dbWord.Locale], dbWord.Word)
+		}
+	}
+	cfg.profanity.SetOverrides(added, removed)
+	return nil
+}
+
+type ProfanityLists struct {
+	Mode  filter.Mode         `json:"mode"`
+	Lists map[string][]string `json:"lists"`
+}
+
+// GET /admin/profanity, the effective lists, normalized
+func (cfg *apiConfig) listProfanityWords(w http.ResponseWriter, r *http.Request) {
+	lists := ProfanityLists{
+		Mode:  cfg.profanity.Mode(),
+		Lists: map[string][]string{},
+	}
+	for _, locale := range cfg.profanity.Locales() {
+		lists.Lists[locale] = cfg.profanity.Words(locale)
+	}
+
+	if err := respondWithJSON(w, 200, lists); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// PUT /admin/profanity/{locale}/{word} lists a word, DELETE unlists it, files
+// included
+func (cfg *apiConfig) setProfanityWord(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	locale := strings.ToLower(r.PathValue("locale"))
+	if _, err = language.ParseBase(locale); err != nil {
+		errorMsg = fmt.Sprintf("invalid locale %q: %v", locale, err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	word := filter.Normalize(r.PathValue("word"))
+	if word == "" {
+		errorMsg = "word has no letters in it"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	err = cfg.dbQueries.SetProfanityWord(r.Context(), database.SetProfanityWordParams{
+		Locale:    locale,
+		Word:      word,
+		Listed:    r.Method == http.MethodPut,
+		UpdatedBy: adminUserID(r),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not update word list: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	// other instances catch up on their next sync
+	if err = cfg.syncProfanityWords(r.Context()); err != nil {
+		log.Printf("could not sync profanity words: %v", err)
+	}
+
+	log.Printf("user %v set %q for %s to listed=%v", adminUserID(r).UUID, word, locale, r.Method == http.MethodPut)
+	w.WriteHeader(204)
+}
+
+type FlaggedChirp struct {
+	Chirp
+	FlaggedAt    time.Time `json:"flagged_at"`
+	FlaggedWords []string  `json:"flagged_words"`
+}
+
+// GET /admin/chirps/flagged?limit=100, oldest first
+func (cfg *apiConfig) listFlaggedChirps(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 1000 {
+			errorMsg = "limit must be between 1 and 1000"
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	dbChirps, err := cfg.dbQueries.ListFlaggedChirps(r.Context(), int32(limit))
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list flagged chirps: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	flaggedChirps := make([]FlaggedChirp, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		flaggedChirps = append(flaggedChirps, FlaggedChirp{
+			Chirp:        chirpFromDB(dbChirp),
+			FlaggedAt:    dbChirp.FlaggedAt.Time,
+			FlaggedWords: dbChirp.FlaggedWords,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, flaggedChirps); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// POST /admin/chirps/{chirpID}/review {"action": "approve" | "remove"}
+func (cfg *apiConfig) reviewFlaggedChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	type parameters struct {
+		Action string `json:"action"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	switch params.Action {
+	case "approve":
+		cleared, err := cfg.dbQueries.ClearChirpFlag(r.Context(), chirpID)
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not approve chirp: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		if cleared == 0 {
+			errorMsg = "no flagged chirp with that id"
+			log.Print(errorMsg)
+			respondWithError(w, 404, errorMsg)
+			return
+		}
+	case "remove":
+		// kept until the purge job as evidence, the author can't restore it
+		removed, err := cfg.dbQueries.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+			ID:        chirpID,
+			DeletedBy: adminUserID(r),
+		})
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not remove chirp: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		if removed == 0 {
+			errorMsg = "no chirp with that id"
+			log.Print(errorMsg)
+			respondWithError(w, 404, errorMsg)
+			return
+		}
+	default:
+		errorMsg = `action must be "approve" or "remove"`
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	log.Printf("user %v reviewed flagged chirp %v: %s", adminUserID(r).UUID, chirpID, params.Action)
+	w.WriteHeader(204)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/polka"
+	"github.com/google/uuid"
+)
+
+// reconcilePolka compares Polka's view of who pays with our subscriptions and
+// prints the differences. a webhook that failed for good (404, a bug, an
+// outage longer than polka retries) is only noticed here. with -apply polka
+// wins and every fix is written to billing_reconciliations
+func reconcilePolka(ctx context.Context, db *sql.DB, q *database.Queries, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("reconcile-polka", flag.ContinueOnError)
+	file := flags.String("file", "", "polka export to compare against, .csv or .json")
+	apiURL := flags.String("api", "", "polka api base url to fetch memberships from, uses POLKA_API_KEY")
+	apply := flags.Bool("apply", false, "fix our side, otherwise only report")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*file == "") == (*apiURL == "") {
+		return fmt.Errorf("usage: chirpy reconcile-polka (-file <export> | -api <url>) [-apply]")
+	}
+
+	var polkaSide []polka.Membership
+	var source string
+	var err error
+	if *file != "" {
+		source = *file
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		polkaSide, err = polka.ReadExport(f, *file)
+		if err != nil {
+			return err
+		}
+	} else {
+		source = *apiURL
+		client := &polka.Client{BaseURL: *apiURL, APIKey: os.Getenv("POLKA_API_KEY"), HTTP: &http.Client{Timeout: 30 * time.Second}}
+		polkaSide, err = client.Memberships(ctx)
+		if err != nil {
+			return fmt.Errorf("could not fetch polka memberships: %w", err)
+		}
+	}
+
+	dbStates, err := q.ListMembershipStates(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list memberships: %w", err)
+	}
+	localSide := make([]polka.Membership, 0, len(dbStates))
+	for _, state := range dbStates {
+		localSide = append(localSide, polka.Membership{
+			UserID:    state.UserID,
+			Status:    state.Status,
+			PeriodEnd: state.CurrentPeriodEnd.Time,
+		})
+	}
+
+	polkaIDs := make([]uuid.UUID, 0, len(polkaSide))
+	for _, m := range polkaSide {
+		polkaIDs = append(polkaIDs, m.UserID)
+	}
+	existing, err := q.FilterExistingUserIDs(ctx, polkaIDs)
+	if err != nil {
+		return fmt.Errorf("could not look up users: %w", err)
+	}
+	known := map[uuid.UUID]bool{}
+	for _, id := range existing {
+		known[id] = true
+	}
+
+	discrepancies := polka.Diff(polkaSide, localSide, known, time.Now())
+
+	runID := uuid.New()
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tUSER\tPOLKA\tCHIRPY\tACTION")
+	applied := 0
+	for _, d := range discrepancies {
+		action := reconcileAction(d)
+		if *apply && d.Kind != polka.KindUnknownUser {
+			if err = applyReconciliation(ctx, db, q, runID, source, d, action); err != nil {
+				action = fmt.Sprintf("failed: %v", err)
+			} else {
+				applied++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Kind, d.UserID, describeMembership(d.Polka), describeMembership(d.Local), action)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(out, "\n%d memberships at polka, %d here, %d discrepancies", len(polkaSide), len(localSide), len(discrepancies))
+	if *apply {
+		fmt.Fprintf(out, ", %d fixed in run %s", applied, runID)
+	} else if len(discrepancies) > 0 {
+		fmt.Fprint(out, ", run with -apply to fix")
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+func reconcileAction(d polka.Discrepancy) string {
+	switch {
+	case d.Kind == polka.KindUnknownUser:
+		return "none, no such user"
+	case d.Polka == nil:
+		return "end as expired"
+	default:
+		return fmt.Sprintf("set %s until %s", d.Polka.Status, d.Polka.PeriodEnd.Format(time.RFC3339))
+	}
+}
+
+// one transaction per user, a failure doesn't stop the rest
+func applyReconciliation(ctx context.Context, db *sql.DB, q *database.Queries, runID uuid.UUID, source string, d polka.Discrepancy, action string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := q.WithTx(tx)
+
+	switch {
+	case d.Polka == nil:
+		_, err = qtx.EndSubscription(ctx, database.EndSubscriptionParams{
+			UserID: d.UserID,
+			Status: polka.StatusExpired,
+		})
+	default:
+		err = qtx.SetSubscription(ctx, database.SetSubscriptionParams{
+			UserID:           d.UserID,
+			Status:           d.Polka.Status,
+			Source:           "reconciliation",
+			CurrentPeriodEnd: sql.NullTime{Time: d.Polka.PeriodEnd, Valid: true},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	entry := database.CreateBillingReconciliationParams{
+		RunID:  runID,
+		Source: source,
+		UserID: d.UserID,
+		Kind:   d.Kind,
+		Action: action,
+	}
+	if d.Polka != nil {
+		entry.PolkaStatus = sql.NullString{String: d.Polka.Status, Valid: true}
+		entry.PolkaPeriodEnd = sql.NullTime{Time: d.Polka.PeriodEnd, Valid: true}
+	}
+	if d.Local != nil {
+		entry.LocalStatus = sql.NullString{String: d.Local.Status, Valid: true}
+		entry.LocalPeriodEnd = sql.NullTime{Time: d.Local.PeriodEnd, Valid: !d.Local.PeriodEnd.IsZero()}
+	}
+	if err = qtx.CreateBillingReconciliation(ctx, entry); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("reconciled %s for user %v: %s", d.Kind, d.UserID, action)
+	return nil
+}
+
+func describeMembership(m *polka.Membership) string {
+	if m == nil {
+		return "-"
+	}
+	if m.PeriodEnd.IsZero() {
+		return fmt.Sprintf("%s, no known end", m.Status)
+	}
+	return fmt.Sprintf("%s until %s", m.Status, m.PeriodEnd.Format(time.DateOnly))
+}
+
+type BillingReconciliation struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RunID          uuid.UUID  `json:"run_id"`
+	Source         string     `json:"source"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Kind           string     `json:"kind"`
+	Action         string     `json:"action"`
+	PolkaStatus    *string    `json:"polka_status"`
+	PolkaPeriodEnd *time.Time `json:"polka_period_end"`
+	LocalStatus    *string    `json:"local_status"`
+	LocalPeriodEnd *time.Time `json:"local_period_end"`
+}
+
+// GET /admin/billing/reconciliations?limit=100, the audit trail of -apply
+func (cfg *apiConfig) listBillingReconciliations(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 1000 {
+			errorMsg = "limit must be between 1 and 1000"
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	dbEntries, err := cfg.dbQueries.ListBillingReconciliations(r.Context(), int32(limit))
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list reconciliations: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	entries := make([]BillingReconciliation, 0, len(dbEntries))
+	for _, dbEntry := range dbEntries {
+		entry := BillingReconciliation{
+			ID:        dbEntry.ID,
+			CreatedAt: dbEntry.CreatedAt,
+			RunID:     dbEntry.RunID,
+			Source:    dbEntry.Source,
+			UserID:    dbEntry.UserID,
+			Kind:      dbEntry.Kind,
+			Action:    dbEntry.Action,
+		}
+		if dbEntry.PolkaStatus.Valid {
+			entry.PolkaStatus = &dbEntry.PolkaStatus.String
+			entry.PolkaPeriodEnd = &dbEntry.PolkaPeriodEnd.Time
+		}
+		if dbEntry.LocalStatus.Valid {
+			entry.LocalStatus = &dbEntry.LocalStatus.String
+			entry.LocalPeriodEnd = &dbEntry.LocalPeriodEnd.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = respondWithJSON(w, 200, entries); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// POST /admin/users/{userID}/revoke_tokens, every access token the user got
+// before "before" (RFC 3339, default now) stops working. refresh tokens are
+// left alone, DELETE /api/sessions or a password reset takes care of those
+func (cfg *apiConfig) revokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	type parameters struct {
+		Before *time.Time `json:"before"`
+	}
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err = decoder.Decode(&params); err != nil {
+			errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+	}
+
+	before := time.Now()
+	if params.Before != nil {
+		if params.Before.After(before) {
+			errorMsg = "before can't be in the future"
+			log.Print(errorMsg)
+			respondWithError(w, 400, errorMsg)
+			return
+		}
+		before = *params.Before
+	}
+
+	if _, err = cfg.dbQueries.GetUserByID(r.Context(), userID); err != nil {
+		errorMsg = fmt.Sprintf("user not found: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	if err = cfg.denylist.RevokeUserTokensBefore(r.Context(), userID, before); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke access tokens: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	log.Printf("revoked access tokens of user %v issued before %v", userID, before)
+	w.WriteHeader(204)
+}
+
+// POST /admin/tokens/revoke, denies one leaked access token by its jti
+func (cfg *apiConfig) revokeToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	// an expired or forged token can't be used anyway, nothing to deny
+	claims, err := cfg.signer.ParseAccessToken(params.Token)
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid token: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		errorMsg = "token has no jti or expiry, revoke the user's tokens instead"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if err = cfg.denylist.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke token: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	log.Printf("revoked access token %s of user %s", claims.ID, claims.Subject)
+	w.WriteHeader(204)
+}
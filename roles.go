@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type adminUserIDKey struct{}
+
+// the account behind an admin request, set by middlewareRole
+func adminUserID(r *http.Request) uuid.NullUUID {
+	userID, ok := r.Context().Value(adminUserIDKey{}).(uuid.UUID)
+	return uuid.NullUUID{UUID: userID, Valid: ok}
+}
+
+func (cfg *apiConfig) userRole(ctx context.Context, userID uuid.UUID) (string, error) {
+	granted, err := cfg.dbQueries.ListUserRoles(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return auth.HighestRole(granted), nil
+}
+
+// middlewareRole lets through logged in accounts that have at least role. the
+// role claim in the token can be an hour stale, so the database decides
+func (cfg *apiConfig) middlewareRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearerToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			errorMsg := fmt.Sprintf("authorization error: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, http.StatusUnauthorized, errorMsg)
+			return
+		}
+
+		userID, ok := cfg.authorizeAccessToken(w, bearerToken, auth.ScopeAdmin)
+		if !ok {
+			return
+		}
+
+		userRole, err := cfg.userRole(r.Context(), userID)
+		if err != nil {
+			errorMsg := fmt.Sprintf("database error, could not get role: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		if !auth.RoleAtLeast(userRole, role) {
+			errorMsg := fmt.Sprintf("requires the %s role", role)
+			log.Printf("%s, user %v is %s", errorMsg, userID, userRole)
+			respondWithError(w, http.StatusForbidden, errorMsg)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), adminUserIDKey{}, userID)))
+	}
+}
+
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UserRoles struct {
+	UserID uuid.UUID `json:"user_id"`
+	Role   string    `json:"role"`
+	// granted ones, RoleUser is never stored
+	Granted []string `json:"granted"`
+}
+
+func (cfg *apiConfig) listRoles(w http.ResponseWriter, r *http.Request) {
+	dbRoles, err := cfg.dbQueries.ListRoles(r.Context())
+	if err != nil {
+		errorMsg := fmt.Sprintf("database error, could not list roles: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	roles := make([]Role, 0, len(dbRoles))
+	for _, dbRole := range dbRoles {
+		roles = append(roles, Role{
+			Name:        dbRole.Name,
+			Description: dbRole.Description,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, roles); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+func (cfg *apiConfig) getUserRoles(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	cfg.respondWithUserRoles(w, r, userID)
+}
+
+// POST /admin/users/{userID}/roles {"role": "moderator"}
+func (cfg *apiConfig) grantRole(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err = decoder.Decode(&params); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	if params.Role == auth.RoleUser || !slices.Contains(auth.Roles, params.Role) {
+		errorMsg = fmt.Sprintf("role must be one of %v", auth.Roles[1:])
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if _, err = cfg.dbQueries.GetUserByID(r.Context(), userID); err != nil {
+		errorMsg = fmt.Sprintf("user not found: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	err = cfg.dbQueries.GrantRole(r.Context(), database.GrantRoleParams{
+		UserID:    userID,
+		Role:      params.Role,
+		GrantedBy: adminUserID(r),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not grant role: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	log.Printf("user %v granted %s to user %v", adminUserID(r).UUID, params.Role, userID)
+	cfg.respondWithUserRoles(w, r, userID)
+}
+
+// DELETE /admin/users/{userID}/roles/{role}
+func (cfg *apiConfig) revokeRole(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	role := r.PathValue("role")
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// two admins revoking each other at once would both count one left,
+	// holding the rows makes the second wait and count again
+	if role == auth.RoleAdmin {
+		if _, err = qtx.LockRoleHolders(r.Context(), role); err != nil {
+			errorMsg = fmt.Sprintf("database error, could not lock admins: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+	}
+
+	revoked, err := qtx.RevokeRole(r.Context(), database.RevokeRoleParams{
+		UserID: userID,
+		Role:   role,
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke role: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if revoked == 0 {
+		errorMsg = fmt.Sprintf("user does not have the %s role", role)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	// nobody could get admin back without the cli
+	if role == auth.RoleAdmin {
+		admins, err := qtx.CountUsersWithRole(r.Context(), auth.RoleAdmin)
+		if err != nil {
+			errorMsg = fmt.Sprintf("database error, could not count admins: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 500, errorMsg)
+			return
+		}
+		if admins == 0 {
+			errorMsg = "can't revoke the last admin"
+			log.Print(errorMsg)
+			respondWithError(w, 409, errorMsg)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit role change: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	log.Printf("user %v revoked %s from user %v", adminUserID(r).UUID, role, userID)
+	cfg.respondWithUserRoles(w, r, userID)
+}
+
+func (cfg *apiConfig) respondWithUserRoles(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	granted, err := cfg.dbQueries.ListUserRoles(r.Context(), userID)
+	if err != nil {
+		errorMsg := fmt.Sprintf("database error, could not list roles: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	userRoles := UserRoles{
+		UserID:  userID,
+		Role:    auth.HighestRole(granted),
+		Granted: granted,
+	}
+	if userRoles.Granted == nil {
+		userRoles.Granted = []string{}
+	}
+
+	if err = respondWithJSON(w, 200, userRoles); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// makeAdmin is for the cli, the first admin can't be granted over the api
+func makeAdmin(ctx context.Context, q *database.Queries, email string) error {
+	dbUser, err := q.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user with email %s, sign up first", email)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = q.GrantRole(ctx, database.GrantRoleParams{
+		UserID: dbUser.ID,
+		Role:   auth.RoleAdmin,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("user %v (%s) is now an admin", dbUser.ID, dbUser.Email)
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// a session is one refresh token family, i.e. one login or one oauth grant
+// (ClientID set). its id is the family id, the refresh token itself is never
+// shown
+type Session struct {
+	ID         uuid.UUID     `json:"id"`
+	StartedAt  time.Time     `json:"started_at"`
+	LastUsedAt time.Time     `json:"last_used_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	UserAgent  string        `json:"user_agent"`
+	IP         string        `json:"ip"`
+	ClientID   uuid.NullUUID `json:"client_id"`
+}
+
+func (cfg *apiConfig) listSessions(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	dbSessions, err := cfg.dbQueries.ListUserSessions(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not list sessions: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         dbSession.FamilyID,
+			StartedAt:  dbSession.StartedAt,
+			LastUsedAt: dbSession.LastUsedAt,
+			ExpiresAt:  dbSession.ExpiresAt,
+			UserAgent:  dbSession.UserAgent,
+			IP:         dbSession.Ip,
+			ClientID:   dbSession.ClientID,
+		})
+	}
+
+	if err = respondWithJSON(w, 200, sessions); err != nil {
+		errorMsg = fmt.Sprintf("error marshalling JSON: %v", err)
+		log.Print(errorMsg)
+	}
+}
+
+func (cfg *apiConfig) revokeSession(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	// scoped to the user, someone else's session id is just "not found"
+	revoked, err := cfg.dbQueries.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke session: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if revoked == 0 {
+		errorMsg = "no active session with that id"
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// log out everywhere
+func (cfg *apiConfig) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	if err = cfg.dbQueries.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke sessions: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	// and the access tokens still floating around, this one included
+	if err = cfg.denylist.RevokeUserTokensBefore(r.Context(), userID, time.Now()); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not revoke access tokens: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,15 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, revision, body, written_at, replaced_at)
+SELECT
+  gen_random_uuid(),
+  chirps.id,
+  (SELECT COALESCE(MAX(revision), 0) + 1 FROM chirp_revisions WHERE chirp_id = chirps.id),
+  chirps.body,
+  chirps.updated_at,
+  NOW()
+FROM chirps
+WHERE chirps.id = $1;
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY revision ASC;
@@ -1,23 +1,98 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+WITH new_chirp AS (
+  SELECT gen_random_uuid() AS id
+)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, flagged_at, flagged_words, in_reply_to, thread_id)
 VALUES (
-  gen_random_uuid(),
+  (SELECT id FROM new_chirp),
   NOW(),
   NOW(),
-  $1,
-  $2
+  sqlc.arg(body),
+  sqlc.arg(user_id),
+  sqlc.arg(publish_at),
+  CASE WHEN cardinality(sqlc.arg(flagged_words)::text[]) > 0 THEN NOW() END,
+  sqlc.arg(flagged_words)::text[],
+  sqlc.narg(in_reply_to),
+  -- a new conversation unless it is a reply
+  COALESCE(sqlc.narg(thread_id)::uuid, (SELECT id FROM new_chirp))
 )
 RETURNING *;
 -- name: GetChirps :many
 SELECT * FROM chirps
+WHERE deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
 ORDER BY created_at ASC;
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
--- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW());
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), deleted_by = $2
+WHERE id = $1 AND deleted_at IS NULL;
 -- name: GetUserChirps :many
 SELECT * FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= NOW())
+ORDER BY created_at ASC;
+-- name: GetRecentChirpCount :one
+SELECT COUNT(*) AS chirps, COALESCE(MIN(created_at), NOW())::timestamp AS oldest
+FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND created_at > sqlc.arg(since);
+-- name: ListScheduledChirps :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at > NOW()
+ORDER BY publish_at ASC;
+-- name: CountScheduledChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND publish_at > NOW();
+-- name: GetChirpForAuthor :one
+SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL;
+-- name: LockChirp :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = sqlc.arg(body),
+    updated_at = NOW(),
+    flagged_at = CASE WHEN cardinality(sqlc.arg(flagged_words)::text[]) > 0 THEN NOW() END,
+    flagged_words = sqlc.arg(flagged_words)::text[]
+WHERE id = sqlc.arg(id)
+RETURNING *;
+-- name: ListDeletedChirps :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND deleted_by = sqlc.arg(user_id) AND deleted_at > sqlc.arg(deleted_after)::timestamp
+ORDER BY deleted_at DESC;
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id)
+  AND deleted_by = sqlc.arg(user_id)
+  AND deleted_at > sqlc.arg(deleted_after)::timestamp
+RETURNING *;
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < sqlc.arg(deleted_before)::timestamp
+  AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.in_reply_to = chirps.id);
+-- name: ScrubDeletedChirps :execrows
+-- chirps with replies stay as tombstones so their threads hold together,
+-- only what they said goes
+WITH scrubbed_revisions AS (
+  DELETE FROM chirp_revisions
+  WHERE chirp_id IN (
+    SELECT id FROM chirps
+    WHERE deleted_at < sqlc.arg(deleted_before)::timestamp
+  )
+)
+UPDATE chirps
+SET body = '', flagged_at = NULL, flagged_words = NULL
+WHERE deleted_at < sqlc.arg(deleted_before)::timestamp
+  AND body <> '';
+-- name: GetChirpThreadID :one
+SELECT thread_id FROM chirps
+WHERE id = $1 AND (publish_at IS NULL OR publish_at <= NOW());
+-- name: GetThread :many
+-- deleted chirps included, they are shown as tombstones
+SELECT * FROM chirps
+WHERE thread_id = $1 AND (publish_at IS NULL OR publish_at <= NOW())
 ORDER BY created_at ASC;
@@ -0,0 +1,15 @@
+-- name: GetEntitlements :one
+SELECT * FROM entitlements
+WHERE tier = $1;
+-- name: ListEntitlements :many
+SELECT * FROM entitlements
+ORDER BY max_chirp_length;
+-- name: UpdateEntitlements :one
+UPDATE entitlements
+SET updated_at = NOW(),
+    max_chirp_length = $2,
+    chirps_per_hour = $3,
+    max_scheduled_chirps = $4,
+    can_edit = $5
+WHERE tier = $1
+RETURNING *;
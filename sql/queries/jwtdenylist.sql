@@ -0,0 +1,33 @@
+-- name: RevokeJWT :exec
+INSERT INTO revoked_jwts (jti, created_at, expires_at)
+VALUES (
+  $1,
+  NOW(),
+  $2
+)
+ON CONFLICT (jti) DO NOTHING;
+-- name: SetJWTRevocationCutoff :exec
+-- a cutoff only ever moves forward
+INSERT INTO jwt_revocation_cutoffs (user_id, updated_at, revoked_before, expires_at)
+VALUES (
+  $1,
+  NOW(),
+  $2,
+  $3
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+  revoked_before = GREATEST(jwt_revocation_cutoffs.revoked_before, EXCLUDED.revoked_before),
+  expires_at = GREATEST(jwt_revocation_cutoffs.expires_at, EXCLUDED.expires_at);
+-- name: ListRevokedJWTs :many
+SELECT * FROM revoked_jwts
+WHERE expires_at > NOW();
+-- name: ListJWTRevocationCutoffs :many
+SELECT * FROM jwt_revocation_cutoffs
+WHERE expires_at > NOW();
+-- name: DeleteExpiredRevokedJWTs :exec
+DELETE FROM revoked_jwts
+WHERE expires_at <= NOW();
+-- name: DeleteExpiredJWTRevocationCutoffs :exec
+DELETE FROM jwt_revocation_cutoffs
+WHERE expires_at <= NOW();
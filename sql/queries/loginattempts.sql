@@ -0,0 +1,36 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (id, created_at, email, user_id, ip, success)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4
+);
+-- name: GetAccountLoginFailures :one
+-- failures since the last successful login, inside the window
+SELECT COUNT(*) AS failures, COALESCE(MAX(f.created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts f
+WHERE f.email = sqlc.arg(email)
+  AND f.success = false
+  AND f.created_at > sqlc.arg(since)
+  AND f.created_at > COALESCE(
+    (SELECT MAX(s.created_at) FROM login_attempts s WHERE s.email = sqlc.arg(email) AND s.success = true),
+    'epoch'
+  );
+-- name: GetIPLoginFailures :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts
+WHERE ip = sqlc.arg(ip)
+  AND success = false
+  AND created_at > sqlc.arg(since);
+-- name: ListLoginAttempts :many
+SELECT * FROM login_attempts
+WHERE (sqlc.narg(email)::text IS NULL OR email = sqlc.narg(email))
+  AND (sqlc.narg(ip)::text IS NULL OR ip = sqlc.narg(ip))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(lim);
+-- name: DeleteLoginAttemptsBefore :exec
+DELETE FROM login_attempts
+WHERE created_at < $1;
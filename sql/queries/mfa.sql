@@ -0,0 +1,45 @@
+-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret, confirmed_at, last_used_step)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  NULL,
+  0
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = NOW(), last_used_step = 0
+WHERE totp_secrets.confirmed_at IS NULL
+RETURNING *;
+-- name: GetTOTPSecret :one
+SELECT * FROM totp_secrets
+WHERE user_id = $1;
+-- name: ConfirmTOTPSecret :exec
+UPDATE totp_secrets
+SET confirmed_at = NOW(), updated_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+-- name: UseTOTPStep :one
+UPDATE totp_secrets
+SET last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2
+RETURNING *;
+-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = $1;
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, user_id, used_at)
+VALUES (
+  $1,
+  NOW(),
+  $2,
+  NULL
+);
+-- name: UseRecoveryCode :one
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL
+RETURNING *;
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
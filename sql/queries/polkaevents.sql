@@ -0,0 +1,12 @@
+-- name: RecordPolkaEvent :execrows
+INSERT INTO polka_events (id, event, user_id, processed_at)
+VALUES (
+  $1,
+  $2,
+  $3,
+  NOW()
+)
+ON CONFLICT (id) DO NOTHING;
+-- name: DeletePolkaEventsBefore :exec
+DELETE FROM polka_events
+WHERE processed_at < $1;
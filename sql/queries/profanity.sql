@@ -0,0 +1,23 @@
+-- name: ListProfanityWords :many
+SELECT * FROM profanity_words
+ORDER BY locale, word;
+-- name: SetProfanityWord :exec
+INSERT INTO profanity_words (locale, word, listed, updated_at, updated_by)
+VALUES (
+  $1,
+  $2,
+  $3,
+  NOW(),
+  $4
+)
+ON CONFLICT (locale, word) DO UPDATE
+SET listed = EXCLUDED.listed, updated_at = NOW(), updated_by = EXCLUDED.updated_by;
+-- name: ListFlaggedChirps :many
+SELECT * FROM chirps
+WHERE flagged_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY flagged_at ASC
+LIMIT $1;
+-- name: ClearChirpFlag :execrows
+UPDATE chirps
+SET flagged_at = NULL, flagged_words = NULL
+WHERE id = $1 AND flagged_at IS NOT NULL AND deleted_at IS NULL;
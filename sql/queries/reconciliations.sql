@@ -0,0 +1,19 @@
+-- name: CreateBillingReconciliation :exec
+INSERT INTO billing_reconciliations (id, created_at, run_id, source, user_id, kind, action, polka_status, polka_period_end, local_status, local_period_end)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9
+);
+-- name: ListBillingReconciliations :many
+SELECT * FROM billing_reconciliations
+ORDER BY created_at DESC
+LIMIT $1;
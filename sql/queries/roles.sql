@@ -0,0 +1,26 @@
+-- name: ListRoles :many
+SELECT * FROM roles
+ORDER BY name;
+-- name: ListUserRoles :many
+SELECT role FROM user_roles
+WHERE user_id = $1
+ORDER BY role;
+-- name: GrantRole :exec
+INSERT INTO user_roles (user_id, role, created_at, granted_by)
+VALUES (
+  $1,
+  $2,
+  NOW(),
+  $3
+)
+ON CONFLICT (user_id, role) DO NOTHING;
+-- name: RevokeRole :execrows
+DELETE FROM user_roles
+WHERE user_id = $1 AND role = $2;
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM user_roles
+WHERE role = $1;
+-- name: LockRoleHolders :many
+SELECT user_id FROM user_roles
+WHERE role = $1
+FOR UPDATE;
@@ -0,0 +1,18 @@
+-- name: ListSigningKeys :many
+SELECT * FROM signing_keys
+ORDER BY activates_at;
+-- name: CreateSigningKey :execrows
+INSERT INTO signing_keys (kid, private_key_pem, created_at, activates_at)
+VALUES (
+  $1,
+  $2,
+  NOW(),
+  $3
+)
+ON CONFLICT (kid) DO NOTHING;
+-- name: DeleteReplacedSigningKeys :exec
+DELETE FROM signing_keys
+WHERE EXISTS (
+  SELECT 1 FROM signing_keys newer
+  WHERE newer.activates_at > signing_keys.activates_at AND newer.activates_at < sqlc.arg(before)
+);
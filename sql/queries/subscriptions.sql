@@ -0,0 +1,57 @@
+-- name: GetSubscriptionForUpdate :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+-- name: SaveSubscription :exec
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, source, current_period_start, current_period_end, cancelled_at)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  $3,
+  $4,
+  $5,
+  $6
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+    status = EXCLUDED.status,
+    source = EXCLUDED.source,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    cancelled_at = EXCLUDED.cancelled_at;
+-- name: EndSubscription :execrows
+UPDATE subscriptions
+SET updated_at = NOW(), status = $2, current_period_end = LEAST(current_period_end, NOW())
+WHERE user_id = $1 AND status IN ('active', 'cancelled');
+-- name: ExpireSubscriptions :many
+-- bookkeeping only, users stop being red when the period ends either way
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'expired'
+WHERE status IN ('active', 'cancelled') AND current_period_end <= NOW()
+RETURNING user_id;
+-- name: SetSubscription :exec
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, source, current_period_start, current_period_end)
+VALUES (
+  $1,
+  NOW(),
+  NOW(),
+  $2,
+  $3,
+  NOW(),
+  $4
+)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+    status = EXCLUDED.status,
+    source = EXCLUDED.source,
+    current_period_end = EXCLUDED.current_period_end;
+-- name: ListMembershipStates :many
+SELECT user_id, status, current_period_end FROM subscriptions;
+-- name: FilterExistingUserIDs :many
+SELECT id FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+-- name: IsChirpyRed :one
+SELECT is_chirpy_red FROM user_memberships
+WHERE user_id = $1;
@@ -15,10 +15,39 @@ SELECT * FROM users
 WHERE email = $1;
 -- name: UpdateUserEmailAndPassword :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
+SET email = $1,
+  hashed_password = $2,
+  email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
+  updated_at = NOW()
 WHERE id = $3
 RETURNING *;
--- name: UpgradeUserByID :exec
-UPDATE users
-SET is_chirpy_red = true, updated_at = NOW()
+-- name: GetUserByID :one
+SELECT * FROM users
 WHERE id = $1;
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+RETURNING *;
+-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+-- name: RehashUserPassword :exec
+-- only if nobody changed the password in the meantime
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hash);
+-- name: ImportUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, email_verified_at)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  NOW(),
+  $1,
+  $2,
+  $3
+)
+ON CONFLICT (email) DO NOTHING
+RETURNING *;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  ip VARCHAR(64) NOT NULL,
+  success BOOL NOT NULL
+);
+
+CREATE INDEX login_attempts_email_idx ON login_attempts (email, created_at);
+CREATE INDEX login_attempts_ip_idx ON login_attempts (ip, created_at);
+
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE revoked_jwts (
+  jti VARCHAR(64) PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE jwt_revocation_cutoffs (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  updated_at TIMESTAMP NOT NULL,
+  revoked_before TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE jwt_revocation_cutoffs;
+DROP TABLE revoked_jwts;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE roles (
+  name VARCHAR(32) PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+INSERT INTO roles (name, description) VALUES
+  ('user', 'every account, implied'),
+  ('moderator', 'can look at login attempts and revoke tokens'),
+  ('admin', 'everything under /admin, including granting roles');
+
+CREATE TABLE user_roles (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(32) NOT NULL REFERENCES roles(name),
+  created_at TIMESTAMP NOT NULL,
+  granted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  PRIMARY KEY (user_id, role)
+);
+
+
+-- +goose Down
+DROP TABLE user_roles;
+DROP TABLE roles;
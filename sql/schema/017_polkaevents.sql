@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE polka_events (
+  id TEXT PRIMARY KEY,
+  event TEXT NOT NULL,
+  user_id UUID,
+  processed_at TIMESTAMP NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE polka_events;
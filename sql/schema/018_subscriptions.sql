@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('active', 'cancelled', 'expired', 'refunded')),
+  source TEXT NOT NULL,
+  current_period_start TIMESTAMP NOT NULL,
+  -- NULL for members from before subscriptions, red until polka tells us a
+  -- period
+  current_period_end TIMESTAMP,
+  cancelled_at TIMESTAMP
+);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end)
+WHERE status IN ('active', 'cancelled');
+
+-- existing members never had a period and we don't know when theirs ends,
+-- they stay red until the next renewal from polka (or a reconcile) sets one
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, source, current_period_start, current_period_end)
+SELECT id, NOW(), NOW(), 'active', 'legacy', NOW(), NULL
+FROM users
+WHERE is_chirpy_red;
+
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE entitlements (
+  tier VARCHAR(32) PRIMARY KEY,
+  updated_at TIMESTAMP NOT NULL,
+  max_chirp_length INTEGER NOT NULL CHECK (max_chirp_length > 0),
+  chirps_per_hour INTEGER NOT NULL CHECK (chirps_per_hour > 0),
+  max_scheduled_chirps INTEGER NOT NULL CHECK (max_scheduled_chirps >= 0),
+  can_edit BOOL NOT NULL
+);
+
+INSERT INTO entitlements (tier, updated_at, max_chirp_length, chirps_per_hour, max_scheduled_chirps, can_edit) VALUES
+  ('free', NOW(), 140, 30, 0, true),
+  ('red', NOW(), 1000, 300, 50, true);
+
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP;
+
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN publish_at;
+
+DROP TABLE entitlements;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- one row per fix applied by "chirpy reconcile-polka --apply", kept after
+-- the user is gone
+CREATE TABLE billing_reconciliations (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  run_id UUID NOT NULL,
+  source TEXT NOT NULL,
+  user_id UUID NOT NULL,
+  kind TEXT NOT NULL,
+  action TEXT NOT NULL,
+  polka_status TEXT,
+  polka_period_end TIMESTAMP,
+  local_status TEXT,
+  local_period_end TIMESTAMP
+);
+
+CREATE INDEX billing_reconciliations_created_at_idx ON billing_reconciliations (created_at);
+
+
+-- +goose Down
+DROP TABLE billing_reconciliations;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- runtime changes to the word lists in files, words are stored normalized
+CREATE TABLE profanity_words (
+  locale VARCHAR(35) NOT NULL,
+  word TEXT NOT NULL,
+  -- false takes a word from the files off the list
+  listed BOOL NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  PRIMARY KEY (locale, word)
+);
+
+ALTER TABLE chirps
+ADD COLUMN flagged_at TIMESTAMP,
+ADD COLUMN flagged_words TEXT[];
+
+CREATE INDEX chirps_flagged_at_idx ON chirps (flagged_at) WHERE flagged_at IS NOT NULL;
+
+
+-- +goose Down
+DROP INDEX chirps_flagged_at_idx;
+
+ALTER TABLE chirps
+DROP COLUMN flagged_words,
+DROP COLUMN flagged_at;
+
+DROP TABLE profanity_words;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- every version of a chirp before its last edit, the current one stays in chirps
+CREATE TABLE chirp_revisions (
+  id UUID PRIMARY KEY,
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  revision INTEGER NOT NULL,
+  body TEXT NOT NULL,
+  written_at TIMESTAMP NOT NULL,
+  replaced_at TIMESTAMP NOT NULL,
+  UNIQUE (chirp_id, revision)
+);
+
+
+-- +goose Down
+DROP TABLE chirp_revisions;
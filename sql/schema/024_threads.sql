@@ -0,0 +1,23 @@
+-- +goose Up
+-- thread_id is the id of the chirp that started the conversation, a chirp
+-- that isn't a reply is its own thread
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN thread_id UUID;
+
+UPDATE chirps SET thread_id = id;
+
+ALTER TABLE chirps
+ALTER COLUMN thread_id SET NOT NULL;
+
+CREATE INDEX chirps_thread_id_idx ON chirps (thread_id);
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to) WHERE in_reply_to IS NOT NULL;
+
+
+-- +goose Down
+DROP INDEX chirps_in_reply_to_idx;
+DROP INDEX chirps_thread_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN thread_id,
+DROP COLUMN in_reply_to;
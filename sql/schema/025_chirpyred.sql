@@ -0,0 +1,31 @@
+-- +goose Up
+-- is_chirpy_red is computed from subscriptions whenever it's read, so it
+-- can't go stale. users keeps its shape otherwise, the flag lives in its own
+-- view
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+CREATE VIEW user_memberships AS
+SELECT
+  users.id AS user_id,
+  EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+      AND subscriptions.status IN ('active', 'cancelled')
+      AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > NOW())
+  ) AS is_chirpy_red
+FROM users;
+
+
+-- +goose Down
+DROP VIEW user_memberships;
+
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOL DEFAULT false NOT NULL;
+
+UPDATE users
+SET is_chirpy_red = true
+WHERE id IN (
+  SELECT user_id FROM subscriptions
+  WHERE status IN ('active', 'cancelled') AND (current_period_end IS NULL OR current_period_end > NOW())
+);
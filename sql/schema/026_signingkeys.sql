@@ -0,0 +1,14 @@
+-- +goose Up
+-- jwt keys rotated in through the admin api. every instance syncs this table
+-- into its keyring, a key verifies as soon as it is here and signs from
+-- activates_at, which is far enough out for the other instances to catch up
+CREATE TABLE signing_keys (
+  kid TEXT PRIMARY KEY,
+  private_key_pem TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  activates_at TIMESTAMP NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE signing_keys;
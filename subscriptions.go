@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/Curator4/chirpy/internal/polka"
+	"github.com/google/uuid"
+)
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+		// optional, only sent for upgrades and renewals
+		PeriodEnd *time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+// polka signs every delivery, see auth.VerifyWebhook (or sends the deprecated
+// POLKA_KEY when no webhook secret is set). deliveries are at least
+// once, so the event id is recorded in the same transaction as the change and
+// a redelivery is acknowledged without applying it again
+func (cfg *apiConfig) polkaWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var err error
+	var errorMsg string
+
+	// the signature is over the raw bytes, read them before decoding
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		errorMsg = fmt.Sprintf("error reading body: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	if cfg.polkaKey != "" {
+		if err = cfg.checkPolkaKey(r.Header); err != nil {
+			errorMsg = fmt.Sprintf("invalid APIKey: %v", err)
+			log.Print(errorMsg)
+			respondWithError(w, 401, errorMsg)
+			return
+		}
+	} else if err = auth.VerifyWebhook(r.Header, cfg.polkaSecret, body, time.Now()); err != nil {
+		errorMsg = fmt.Sprintf("invalid webhook signature: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 401, errorMsg)
+		return
+	}
+
+	event := polkaEvent{}
+	if err = json.Unmarshal(body, &event); err != nil {
+		errorMsg = fmt.Sprintf("error decoding parameters: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+	// unsigned deliveries from before event ids can't be deduplicated
+	if event.ID == "" && cfg.polkaKey != "" {
+		event.ID = uuid.NewString()
+	}
+	if event.ID == "" {
+		errorMsg = "missing event id"
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not start transaction: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	recorded, err := qtx.RecordPolkaEvent(r.Context(), database.RecordPolkaEventParams{
+		ID:     event.ID,
+		Event:  event.Event,
+		UserID: uuid.NullUUID{UUID: event.Data.UserID, Valid: event.Data.UserID != uuid.Nil},
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not record event: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+	if recorded == 0 {
+		log.Printf("polka event %s already processed, skipping", event.ID)
+		w.WriteHeader(204)
+		return
+	}
+
+	// errors roll back, so the event isn't recorded and a retry can still apply
+	if status, err := applyPolkaEvent(r.Context(), qtx, event); err != nil {
+		errorMsg = err.Error()
+		log.Print(errorMsg)
+		respondWithError(w, status, errorMsg)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		errorMsg = fmt.Sprintf("database error, could not commit event: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// the deprecated POLKA_KEY check, polka sends it as "ApiKey <key>"
+func (cfg *apiConfig) checkPolkaKey(headers http.Header) error {
+	apiKey, err := auth.GetAPIKey(headers)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		return errors.New("key does not match")
+	}
+	return nil
+}
+
+// applyPolkaEvent moves the subscription along, see polka.Apply for the
+// rules. is_chirpy_red is derived from it, see user_memberships
+func applyPolkaEvent(ctx context.Context, q *database.Queries, event polkaEvent) (int, error) {
+	userID := event.Data.UserID
+
+	var current *polka.Subscription
+	dbSubscription, err := q.GetSubscriptionForUpdate(ctx, userID)
+	switch {
+	case err == nil:
+		current = &polka.Subscription{
+			Status:      dbSubscription.Status,
+			PeriodStart: dbSubscription.CurrentPeriodStart,
+			PeriodEnd:   dbSubscription.CurrentPeriodEnd.Time,
+		}
+		if dbSubscription.CancelledAt.Valid {
+			current.CancelledAt = &dbSubscription.CancelledAt.Time
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return 500, fmt.Errorf("database error, could not get subscription: %v", err)
+	}
+
+	next, changed, err := polka.Apply(current, event.Event, event.Data.PeriodEnd, time.Now())
+	switch {
+	case errors.Is(err, polka.ErrUnknownEvent):
+		// acknowledged, polka sends events we have no use for
+		return 204, nil
+	case errors.Is(err, polka.ErrNoSubscription):
+		return 404, fmt.Errorf("user %v has no subscription to renew", userID)
+	case err != nil:
+		return 500, err
+	case !changed:
+		log.Printf("polka %s %s changes nothing for user %v", event.Event, event.ID, userID)
+		return 204, nil
+	}
+
+	if current == nil {
+		if userID == uuid.Nil {
+			return 400, errors.New("empty userID")
+		}
+		if _, err = q.GetUserByID(ctx, userID); err != nil {
+			return 404, fmt.Errorf("user %v could not be found: %v", userID, err)
+		}
+	}
+
+	params := database.SaveSubscriptionParams{
+		UserID:             userID,
+		Status:             next.Status,
+		Source:             "polka",
+		CurrentPeriodStart: next.PeriodStart,
+		CurrentPeriodEnd:   sql.NullTime{Time: next.PeriodEnd, Valid: !next.PeriodEnd.IsZero()},
+	}
+	if next.CancelledAt != nil {
+		params.CancelledAt = sql.NullTime{Time: *next.CancelledAt, Valid: true}
+	}
+	if err = q.SaveSubscription(ctx, params); err != nil {
+		return 500, fmt.Errorf("database error, could not update subscription: %v", err)
+	}
+
+	log.Printf("applied polka %s %s to user %v", event.Event, event.ID, userID)
+	return 204, nil
+}
+
+// lapsed periods (cancelled, or polka never sent the renewal) end here
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) error {
+	userIDs, err := cfg.dbQueries.ExpireSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		log.Printf("chirpy red expired for user %v", userID)
+	}
+	return nil
+}
+
+// redeliveries come within days, a month of ids is plenty
+func (cfg *apiConfig) purgePolkaEvents(ctx context.Context) error {
+	return cfg.dbQueries.DeletePolkaEventsBefore(ctx, time.Now().Add(-30*24*time.Hour))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Curator4/chirpy/internal/chirps"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ThreadChirp is a chirp in a conversation. deleted chirps that have replies
+// are tombstones, only their place in the thread is left
+type ThreadChirp struct {
+	Chirp
+	Deleted    bool          `json:"deleted,omitempty"`
+	Depth      int           `json:"depth"`
+	ReplyCount int           `json:"reply_count"`
+	Replies    []ThreadChirp `json:"replies,omitempty"`
+}
+
+func threadChirpFromNode(node *chirps.Node, dbChirps []database.Chirp) ThreadChirp {
+	threadChirp := ThreadChirp{
+		Deleted:    node.Deleted,
+		Depth:      node.Depth,
+		ReplyCount: node.ReplyCount(),
+	}
+	switch {
+	case node.Index < 0:
+		// the root is gone for good
+		threadChirp.Chirp = Chirp{ID: node.ID, ThreadID: node.ID}
+	case node.Deleted:
+		dbChirp := dbChirps[node.Index]
+		threadChirp.Chirp = Chirp{
+			ID:        dbChirp.ID,
+			CreatedAt: dbChirp.CreatedAt,
+			UpdatedAt: dbChirp.UpdatedAt,
+			ThreadID:  dbChirp.ThreadID,
+		}
+		if dbChirp.InReplyTo.Valid {
+			threadChirp.InReplyTo = &dbChirp.InReplyTo.UUID
+		}
+	default:
+		threadChirp.Chirp = chirpFromDB(dbChirps[node.Index])
+	}
+	return threadChirp
+}
+
+func threadTree(node *chirps.Node, dbChirps []database.Chirp) ThreadChirp {
+	threadChirp := threadChirpFromNode(node, dbChirps)
+	for _, reply := range node.Replies {
+		threadChirp.Replies = append(threadChirp.Replies, threadTree(reply, dbChirps))
+	}
+	return threadChirp
+}
+
+// GET /api/chirps/{chirpID}/thread?format=tree|flat, the whole conversation
+// the chirp is part of. tree (the default) nests replies, flat lists the
+// thread depth first with depth set on each chirp
+func (cfg *apiConfig) getThread(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "tree" && format != "flat" {
+		errorMsg = `format must be "tree" or "flat"`
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	// deleted chirps still lead to their thread
+	threadID, err := cfg.dbQueries.GetChirpThreadID(r.Context(), chirpID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("could not find id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	dbChirps, err := cfg.dbQueries.GetThread(r.Context(), threadID)
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get thread: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	posts := make([]chirps.Post, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		posts = append(posts, chirps.Post{
+			ID:        dbChirp.ID,
+			InReplyTo: dbChirp.InReplyTo,
+			Deleted:   dbChirp.DeletedAt.Valid,
+		})
+	}
+	thread := chirps.BuildThread(threadID, posts)
+
+	if format == "flat" {
+		nodes := thread.Flatten()
+		threadChirps := make([]ThreadChirp, 0, len(nodes))
+		for _, node := range nodes {
+			threadChirps = append(threadChirps, threadChirpFromNode(node, dbChirps))
+		}
+		if err = respondWithJSON(w, 200, threadChirps); err != nil {
+			log.Printf("error marshalling JSON: %v", err)
+		}
+		return
+	}
+
+	if err = respondWithJSON(w, 200, threadTree(thread, dbChirps)); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Curator4/chirpy/internal/auth"
+	"github.com/Curator4/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// how long deleted chirps stick around. authors can restore their own for
+// RestoreWindow, the rest of Retention is for moderators
+type chirpRetention struct {
+	RestoreWindow time.Duration
+	Retention     time.Duration
+}
+
+// CHIRP_RESTORE_WINDOW (default a week) and CHIRP_RETENTION (default 90
+// days) are durations like "72h"
+func loadChirpRetention() (chirpRetention, error) {
+	retention := chirpRetention{
+		RestoreWindow: 7 * 24 * time.Hour,
+		Retention:     90 * 24 * time.Hour,
+	}
+
+	for _, setting := range []struct {
+		env string
+		set *time.Duration
+	}{
+		{"CHIRP_RESTORE_WINDOW", &retention.RestoreWindow},
+		{"CHIRP_RETENTION", &retention.Retention},
+	} {
+		valueStr := os.Getenv(setting.env)
+		if valueStr == "" {
+			continue
+		}
+		value, err := time.ParseDuration(valueStr)
+		if err != nil || value <= 0 {
+			return retention, fmt.Errorf("invalid %s %q", setting.env, valueStr)
+		}
+		*setting.set = value
+	}
+
+	if retention.Retention < retention.RestoreWindow {
+		return retention, fmt.Errorf("CHIRP_RETENTION %v is shorter than CHIRP_RESTORE_WINDOW %v", retention.Retention, retention.RestoreWindow)
+	}
+	return retention, nil
+}
+
+type DeletedChirp struct {
+	Chirp
+	DeletedAt     time.Time `json:"deleted_at"`
+	RestoreBefore time.Time `json:"restore_before"`
+}
+
+// GET /api/chirps/trash, the caller's deleted chirps that can still be
+// restored, most recent first
+func (cfg *apiConfig) listDeletedChirps(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	dbChirps, err := cfg.dbQueries.ListDeletedChirps(r.Context(), database.ListDeletedChirpsParams{
+		UserID:       uuid.NullUUID{UUID: userID, Valid: true},
+		DeletedAfter: time.Now().Add(-cfg.retention.RestoreWindow),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("database error, could not get deleted chirps: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 500, errorMsg)
+		return
+	}
+
+	deletedChirps := make([]DeletedChirp, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		deletedChirps = append(deletedChirps, DeletedChirp{
+			Chirp:         chirpFromDB(dbChirp),
+			DeletedAt:     dbChirp.DeletedAt.Time,
+			RestoreBefore: dbChirp.DeletedAt.Time.Add(cfg.retention.RestoreWindow),
+		})
+	}
+
+	if err = respondWithJSON(w, 200, deletedChirps); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// POST /api/chirps/{chirpID}/restore, only for chirps the author deleted
+// themselves, not ones a moderator removed
+func (cfg *apiConfig) restoreChirp(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var errorMsg string
+
+	userID, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		errorMsg = fmt.Sprintf("invalid id: %v", err)
+		log.Print(errorMsg)
+		respondWithError(w, 400, errorMsg)
+		return
+	}
+
+	dbChirp, err := cfg.dbQueries.RestoreChirp(r.Context(), database.RestoreChirpParams{
+		ID:           chirpID,
+		UserID:       uuid.NullUUID{UUID: userID, Valid: true},
+		DeletedAfter: time.Now().Add(-cfg.retention.RestoreWindow),
+	})
+	if err != nil {
+		errorMsg = fmt.Sprintf("no chirp of yours deleted in the last %v with that id: %v", cfg.retention.RestoreWindow, err)
+		log.Print(errorMsg)
+		respondWithError(w, 404, errorMsg)
+		return
+	}
+
+	if err = respondWithJSON(w, 200, chirpFromDB(dbChirp)); err != nil {
+		log.Printf("error marshalling JSON: %v", err)
+	}
+}
+
+// hard deletes chirps once retention is over, revisions go with them.
+// chirps that still have replies are emptied instead and stay as tombstones
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) error {
+	before := time.Now().Add(-cfg.retention.Retention)
+	purged, err := cfg.dbQueries.PurgeDeletedChirps(ctx, before)
+	if err != nil {
+		return err
+	}
+	scrubbed, err := cfg.dbQueries.ScrubDeletedChirps(ctx, before)
+	if err != nil {
+		return fmt.Errorf("could not scrub chirps with replies: %w", err)
+	}
+	if purged > 0 || scrubbed > 0 {
+		log.Printf("purged %d deleted chirps, scrubbed %d with replies", purged, scrubbed)
+	}
+	return nil
+}